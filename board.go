@@ -25,13 +25,19 @@ package main
 // Some unused rows above and below the reachable playfield let the piece
 // avoid going into out of bounds indexes.
 const (
-	rowsAbove = 5                          // Number of hidden rows above board.
-	slab      = 3                          // Hidden rows below and index of bottom-most reachable row.
-	numRows   = bHeight + slab + rowsAbove // Total board rows
-	roof      = slab + bHeight - 1         // Top-most reachable row
+	rowsAbove = 5                            // Number of hidden rows above board.
+	slab      = 3                            // Hidden rows below and index of bottom-most reachable row.
+	maxRows   = maxHeight + slab + rowsAbove // Rows allocated for the tallest board
 )
 
-type board [numRows]uint64
+// numRows and roof depend on the board height chosen at startup. Rows of the
+// board array at or above numRows are never used.
+var (
+	numRows int // Total board rows
+	roof    int // Top-most reachable row
+)
+
+type board [maxRows]uint64
 
 const pieceRows = 4
 
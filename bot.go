@@ -6,28 +6,52 @@ import (
 	"time"
 )
 
-func (a agent) run() (int, int) {
-	placements := make([]pos, 0, bWidth*3)
-	for false == a.gameOver {
-		placements = placements[:0] // Reuse slice to save allocation time
-		a.pos = findBestPlacement(a.signal, a.strategy, a.findPlacements(a.piece, a.colHeights, placements))
-		if a.pos == (pos{}) { // No placement found
+// run plays until the game ends, or until limit pieces have locked when limit
+// is above 0, and returns the agent's final state.
+func (a agent) run(limit int) agent {
+	s := newSearcher(a.strategy)
+	// Anytime search may think for as long as the bot waits between pieces
+	// unless given its own budget.
+	budget := time.Duration(a.speed) * time.Millisecond
+	if beamBudget > 0 {
+		budget = time.Duration(beamBudget) * time.Millisecond
+	}
+	for false == a.gameOver && (limit == 0 || a.totalPieces < limit) {
+		start := time.Now()
+		var deadline time.Time
+		if budget > 0 {
+			deadline = start.Add(budget)
+		}
+		var ok bool
+		if a, ok = a.play(s, deadline); !ok {
 			a.gameOver = true
-			return a.totalPieces, a.totalLines
+			return a
 		}
 		if a.speed > 0 {
 			a.print()
-			time.Sleep(time.Duration(a.speed) * time.Millisecond)
+			time.Sleep(time.Until(start.Add(time.Duration(a.speed) * time.Millisecond)))
 		}
 		a = a.lockAndNewPiece()
 	}
-	return a.totalPieces, a.totalLines
+	return a
+}
+
+// play moves the active piece to the placement the searcher chooses, holding
+// first if it chooses to, but leaves locking it to the caller. It returns false
+// if no placement is found.
+func (a agent) play(s *searcher, deadline time.Time) (agent, bool) {
+	p, hold := s.bestMove(a, deadline)
+	if hold {
+		a = a.holdPiece()
+	}
+	a.pos = p
+	return a, p != (pos{})
 }
 
 // findPlacements returns a slice of pos of placements that can be gotten to
 // without softdropping and sliding or rotating under overhangs. This method
 // uses simple height subtraction in order to avoid need for collision checks.
-func (b board) findPlacements(piece int, colHeights [bWidth]int, placements []pos) []pos {
+func (b board) findPlacements(piece int, colHeights [maxWidth]int, placements []pos) []pos {
 	for form := 0; form < tableUsedForms[piece]; form++ {
 		for x := tableXStart[piece][form]; x <= tableXStop[piece][form]; x++ {
 			var landingRow int
@@ -42,29 +66,159 @@ func (b board) findPlacements(piece int, colHeights [bWidth]int, placements []po
 					landingRow = currentLandingRow
 				}
 			}
-			placements = append(placements, pos{piece, form, landingRow, x})
+			placements = append(placements, pos{piece, form, landingRow, x, moveDrop})
+		}
+	}
+	return placements
+}
+
+// candidatePlacements returns the placements for piece found by the
+// placement generator chosen at startup.
+func (s signal) candidatePlacements(piece int, placements []pos) []pos {
+	if reachableSearch {
+		return s.findReachable(piece, placements)
+	}
+	return s.findPlacements(piece, s.colHeights, placements)
+}
+
+// Bounds of the pos coordinates findReachable keeps track of.
+const (
+	reachRows  = maxRows
+	reachCols  = maxWidth + formCols
+	reachLimit = numForms * reachRows * reachCols
+)
+
+// findReachable returns every placement the piece can lock into starting from
+// its spawn column and orientation, including ones reached by softdropping
+// and then sliding or rotating under overhangs. It does a breadth-first search
+// over single moves, drops and rotations using the rotation system chosen at
+// startup, so it is much slower than findPlacements. Placements covering the
+// same cells as one found earlier are skipped.
+func (b board) findReachable(piece int, placements []pos) []pos {
+	// Enter at the top of the playfield, since findPlacements also drops pieces
+	// in from above.
+	start := defaultPos(piece)
+	for start.descend(-1).inBounds() {
+		start = start.descend(-1)
+	}
+	if !b.allows(start) {
+		return placements
+	}
+	// Positions are packed into a uint16 so the queue can live on the stack.
+	// Since the packing leaves out how a position was reached, the best
+	// lastMove seen for each one is kept separately.
+	var visited [reachLimit]bool
+	var lastMoves [reachLimit]int8
+	var queue [reachLimit]uint16
+	pack := func(p pos) uint16 { return uint16((p.form*reachRows+p.y)*reachCols + p.x) }
+	unpack := func(i uint16) pos {
+		n := int(i)
+		return pos{piece, n / reachCols / reachRows, n / reachCols % reachRows, n % reachCols, int(lastMoves[i])}
+	}
+	visited[pack(start)] = true
+	queue[0] = pack(start)
+	tail := 1
+	for head := 0; head < tail; head++ {
+		p := unpack(queue[head])
+		moves := [6]pos{p.move(-1), p.move(1), p.descend(1)}
+		n := 3
+		for _, delta := range rotationDeltas() {
+			if r, ok := rotationSys.rotate(b, p, delta); ok {
+				moves[n] = r
+				n++
+			}
+		}
+		for _, next := range moves[:n] {
+			if next.x >= reachCols || next.y >= reachRows || !b.allows(next) {
+				continue
+			}
+			i := pack(next)
+			if int8(next.lastMove) > lastMoves[i] {
+				lastMoves[i] = int8(next.lastMove)
+			}
+			if !visited[i] {
+				visited[i] = true
+				queue[tail] = i
+				tail++
+			}
+		}
+	}
+	// Positions are only collected once the search is over, so they have
+	// the best lastMove that reaches them.
+	for _, i := range queue[:tail] {
+		p := unpack(i)
+		if b.allows(p.descend(1)) {
+			continue // Not resting on anything.
+		}
+		duplicate := false
+		for j, q := range placements {
+			if p.sameCells(q) {
+				duplicate = true
+				if p.lastMove > q.lastMove {
+					placements[j].lastMove = p.lastMove
+				}
+				break
+			}
+		}
+		if !duplicate {
+			placements = append(placements, p)
 		}
 	}
 	return placements
 }
 
+// sameCells checks if two positions cover exactly the same cells.
+func (p pos) sameCells(q pos) bool {
+	if p.y > q.y {
+		p, q = q, p
+	}
+	for row := p.y; row < q.y+pieceRows; row++ {
+		var pBits, qBits uint64
+		if row < p.y+pieceRows {
+			pBits = p.pieceBits(row - p.y)
+		}
+		if row >= q.y {
+			qBits = q.pieceBits(row - q.y)
+		}
+		if pBits != qBits {
+			return false
+		}
+	}
+	return true
+}
+
+// Set by setBoardSize.
+var (
+	walledRow     uint64 // 100000000001
+	leftBorderRow uint64 // 110000000000
+)
+
+// Number of features every strategy weighs. Strategies may add weights for the
+// combo and back-to-back features after them.
 const (
-	walledRow     = uint64(1<<(bWidth+1) | 1) // 100000000001
-	leftBorderRow = uint64(3 << bWidth)       // 110000000000
+	numCoreFeatures  = 9
+	numChainFeatures = 2
 )
 
-func findBestPlacement(sig signal, strat strategy, placements []pos) pos {
+// findBestPlacement returns the highest scoring placement along with its
+// score. If scores is not nil, the score of every placement is written to it,
+// with placements that top out scoring negative infinity.
+func findBestPlacement(sig signal, strat strategy, placements []pos, scores []float64) (pos, float64) {
 	bestScore := math.Inf(-1)
 	var bestPlacement pos
 	for i := 0; i < len(placements); i++ {
 		var score float64
 		c := sig.lock(placements[i])
 		if c.gameOver {
+			if scores != nil {
+				scores[i] = math.Inf(-1)
+			}
 			continue
 		}
 
-		var heightDiffs [bWidth - 1]int
-		for i := 0; i < len(c.colHeights)-1; i++ {
+		var heightDiffArr [maxWidth - 1]int
+		heightDiffs := heightDiffArr[:bWidth-1]
+		for i := 0; i < len(heightDiffs); i++ {
 			heightDiffs[i] = c.colHeights[i] - c.colHeights[i+1]
 		}
 
@@ -243,12 +397,24 @@ func findBestPlacement(sig signal, strat strategy, placements []pos) pos {
 		}
 		score += strat[8] * float64(safeSZ)
 
+		// Competitive play rewards chains of clears. Strategies only weigh these
+		// when they have weights for them, since they do not help survival.
+		if len(strat) > numCoreFeatures {
+			// combo is the length of the current chain of clearing locks.
+			score += strat[9] * float64(c.combo+1)
+			// backToBack is the length of the current chain of tetrises and spins.
+			score += strat[10] * float64(c.backToBack+1)
+		}
+
 		// ********** END FEATURES *************************************************
 
+		if scores != nil {
+			scores[i] = score
+		}
 		if score > bestScore {
 			bestScore = score
 			bestPlacement = placements[i]
 		}
 	}
-	return bestPlacement
+	return bestPlacement, bestScore
 }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// countingSource counts the values drawn from a source, so the source can be
+// restored by reseeding it and drawing the same number of values again.
+type countingSource struct {
+	src   rand.Source64
+	draws uint64
+}
+
+func newCountingSource(seed int64, draws uint64) *countingSource {
+	c := &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+	for c.draws < draws {
+		c.Uint64()
+	}
+	return c
+}
+
+func (c *countingSource) Int63() int64 {
+	c.draws++
+	return c.src.Int63()
+}
+
+func (c *countingSource) Uint64() uint64 {
+	c.draws++
+	return c.src.Uint64()
+}
+
+func (c *countingSource) Seed(seed int64) {
+	c.src.Seed(seed)
+	c.draws = 0
+}
+
+// tunerCheckpoint is everything needed to continue an optimizer run exactly
+// where it stopped. The board, randomizer, garbage, evaluation and play
+// settings it ran with are kept so that a run is not resumed under different
+// rules.
+type tunerCheckpoint struct {
+	Width, Height    int
+	Randomizer       string
+	Garbage          string
+	GarbageInterval  int
+	GarbageBatch     int
+	PieceLimit       int
+	Survival         bool
+	Racing           bool
+	Play             playSettings
+	Optimizer        string
+	State            json.RawMessage // The optimizer's own state
+	Iterations       int
+	NumOfGames       int
+	Lambda           float64
+	BestStratSingle  strategy
+	BestStratMean    strategy
+	BestResultSingle float64
+	BestResultMean   float64
+	Stale            int
+	Seed             int64
+	Draws            uint64
+}
+
+// saveCheckpoint writes the state of the run to file.
+func (t *tuner) saveCheckpoint(file string) error {
+	state, err := t.opt.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	cp := tunerCheckpoint{
+		Width:            bWidth,
+		Height:           bHeight,
+		Randomizer:       randomizerName,
+		Garbage:          garbagePattern,
+		GarbageInterval:  garbageInterval,
+		GarbageBatch:     garbageBatch,
+		PieceLimit:       pieceLimit,
+		Survival:         survivalEstimate,
+		Racing:           t.racing,
+		Play:             currentPlaySettings(),
+		Optimizer:        t.optName,
+		State:            state,
+		Iterations:       t.iterations,
+		NumOfGames:       t.numOfGames,
+		Lambda:           t.lambda,
+		BestStratSingle:  t.bestStratSingle,
+		BestStratMean:    t.bestStratMean,
+		BestResultSingle: t.bestResultSingle,
+		BestResultMean:   t.bestResultMean,
+		Stale:            t.stale,
+		Seed:             t.seed,
+		Draws:            t.source.draws,
+	}
+	data, err := json.MarshalIndent(cp, "", "\t")
+	if err != nil {
+		return err
+	}
+	return replaceFile(file, data)
+}
+
+// replaceFile writes data to file in one step, so that a run killed while
+// saving leaves the previous contents whole.
+func replaceFile(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// resumeTuner restores a run from a checkpoint file, which must have been
+// racing candidates if racing is set.
+func resumeTuner(file string, racing bool) (tuner, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return tuner{}, err
+	}
+	var cp tunerCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return tuner{}, fmt.Errorf("%s: %v", file, err)
+	}
+	if cp.Width != bWidth || cp.Height != bHeight || cp.Randomizer != randomizerName {
+		return tuner{}, fmt.Errorf("%s was run on a %dx%d board with the %s randomizer, not %dx%d with %s",
+			file, cp.Width, cp.Height, cp.Randomizer, bWidth, bHeight, randomizerName)
+	}
+	if cp.Garbage != garbagePattern || (cp.Garbage != "" &&
+		(cp.GarbageInterval != garbageInterval || cp.GarbageBatch != garbageBatch)) {
+		return tuner{}, fmt.Errorf("%s was run with %s, not %s",
+			file, describeGarbage(cp.Garbage, cp.GarbageInterval, cp.GarbageBatch),
+			describeGarbage(garbagePattern, garbageInterval, garbageBatch))
+	}
+	if cp.PieceLimit != pieceLimit || cp.Survival != survivalEstimate {
+		return tuner{}, fmt.Errorf("%s was run with a piece limit of %d and survival estimates %v, not %d and %v",
+			file, cp.PieceLimit, cp.Survival, pieceLimit, survivalEstimate)
+	}
+	if cp.Racing != racing {
+		return tuner{}, fmt.Errorf("%s was run with racing %v, not %v", file, cp.Racing, racing)
+	}
+	if play := currentPlaySettings(); cp.Play != play {
+		return tuner{}, fmt.Errorf("%s was run with other play settings: %s",
+			file, strings.Join(cp.Play.differences(play), ", "))
+	}
+	newOpt, ok := optimizers[cp.Optimizer]
+	if !ok {
+		return tuner{}, fmt.Errorf("%s: unknown optimizer %q", file, cp.Optimizer)
+	}
+	opt := newOpt(nil, 0)
+	if err := opt.UnmarshalJSON(cp.State); err != nil {
+		return tuner{}, fmt.Errorf("%s: %v", file, err)
+	}
+	t := tuner{
+		opt:              opt,
+		optName:          cp.Optimizer,
+		iterations:       cp.Iterations,
+		numOfGames:       cp.NumOfGames,
+		lambda:           cp.Lambda,
+		bestStratSingle:  cp.BestStratSingle,
+		bestStratMean:    cp.BestStratMean,
+		bestResultSingle: cp.BestResultSingle,
+		bestResultMean:   cp.BestResultMean,
+		stale:            cp.Stale,
+		seed:             cp.Seed,
+		source:           newCountingSource(cp.Seed, cp.Draws),
+		racing:           racing,
+	}
+	t.random = rand.New(t.source)
+	return t, nil
+}
+
+func describeGarbage(pattern string, interval, rows int) string {
+	if pattern == "" {
+		return "no garbage"
+	}
+	return fmt.Sprintf("%s garbage, %d row(s) every %d pieces", pattern, rows, interval)
+}
+
+// playSettings decide how the bot plays and what its games are worth, and so
+// what an optimizer run tunes for.
+type playSettings struct {
+	Search                string
+	Depth, Preview, Prune int
+	Risk                  float64
+	Beam, Budget          int
+	Hold, Reachable       bool
+	Rotation              string
+	Rotate180, AllSpin    bool
+	Scoring               string
+	Level                 int
+	Objective, Attack     string
+}
+
+func currentPlaySettings() playSettings {
+	return playSettings{
+		Search:    searchMode,
+		Depth:     searchDepth,
+		Preview:   numPreview,
+		Prune:     searchPrune,
+		Risk:      searchRisk,
+		Beam:      beamWidth,
+		Budget:    beamBudget,
+		Hold:      holdEnabled,
+		Reachable: reachableSearch,
+		Rotation:  rotationName,
+		Rotate180: allow180,
+		AllSpin:   immobileSpins,
+		Scoring:   scoringName,
+		Level:     startLevel,
+		Objective: objective,
+		Attack:    attackName,
+	}
+}
+
+// differences describes each setting that differs between p and q.
+func (p playSettings) differences(q playSettings) []string {
+	var diffs []string
+	pv, qv := reflect.ValueOf(p), reflect.ValueOf(q)
+	for i := 0; i < pv.NumField(); i++ {
+		if a, b := pv.Field(i).Interface(), qv.Field(i).Interface(); a != b {
+			diffs = append(diffs, fmt.Sprintf("%s %v, not %v", pv.Type().Field(i).Name, a, b))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+)
+
+// cmaes implements the covariance matrix adaptation evolution strategy as
+// described in Hansen's tutorial "The CMA Evolution Strategy". Unlike cross
+// entropy, it learns a full covariance matrix, so weights whose effects are
+// related, such as row and column transitions, can be searched along together.
+type cmaes struct {
+	n, lambda, mu                     int
+	weights                           []float64 // Recombination weights of the best mu candidates
+	muEff                             float64
+	cSigma, dSigma, cc, c1, cMu, chiN float64
+
+	m      strategy    // Mean
+	sigma  float64     // Step size
+	cov    [][]float64 // Covariance matrix
+	pc, ps []float64   // Evolution paths of the covariance and step size
+	// cov = b * diag(d)^2 * b^T, where the columns of b are eigenvectors.
+	b          [][]float64
+	d          []float64
+	generation int
+}
+
+// Starting step size, matching the initial variance of cross entropy.
+var cmaesSigma = math.Sqrt(10)
+
+func newCMAES(start strategy, population int) optimizer {
+	c := &cmaes{m: append(strategy(nil), start...), sigma: cmaesSigma}
+	if len(start) == 0 {
+		return c // Its state comes from a checkpoint instead.
+	}
+	c.setup(len(start), population)
+	c.cov = identity(c.n)
+	c.pc, c.ps = make([]float64, c.n), make([]float64, c.n)
+	c.decompose()
+	return c
+}
+
+// setup derives the strategy parameters from the number of weights n and the
+// population size, where 0 picks the default population.
+func (c *cmaes) setup(n, population int) {
+	c.n = n
+	c.lambda = population
+	if c.lambda == 0 {
+		c.lambda = 4 + int(3*math.Log(float64(n)))
+	}
+	c.mu = c.lambda / 2
+	c.weights = make([]float64, c.mu)
+	var sum, sumSq float64
+	for i := range c.weights {
+		c.weights[i] = math.Log(float64(c.lambda+1)/2) - math.Log(float64(i+1))
+		sum += c.weights[i]
+	}
+	for i := range c.weights {
+		c.weights[i] /= sum
+		sumSq += c.weights[i] * c.weights[i]
+	}
+	c.muEff = 1 / sumSq
+	fn := float64(n)
+	c.cSigma = (c.muEff + 2) / (fn + c.muEff + 5)
+	c.dSigma = 1 + 2*math.Max(0, math.Sqrt((c.muEff-1)/(fn+1))-1) + c.cSigma
+	c.cc = (4 + c.muEff/fn) / (fn + 4 + 2*c.muEff/fn)
+	c.c1 = 2 / ((fn+1.3)*(fn+1.3) + c.muEff)
+	c.cMu = math.Min(1-c.c1, 2*(c.muEff-2+1/c.muEff)/((fn+2)*(fn+2)+c.muEff))
+	c.chiN = math.Sqrt(fn) * (1 - 1/(4*fn) + 1/(21*fn*fn))
+}
+
+func (c *cmaes) candidates(random *rand.Rand, iteration int) []strategy {
+	strats := make([]strategy, c.lambda)
+	z := make([]float64, c.n)
+	for k := range strats {
+		for i := range z {
+			z[i] = random.NormFloat64() * c.d[i]
+		}
+		strats[k] = make(strategy, c.n)
+		for i := range strats[k] {
+			var y float64
+			for j := range z {
+				y += c.b[i][j] * z[j]
+			}
+			strats[k][i] = c.m[i] + c.sigma*y
+		}
+	}
+	return strats
+}
+
+func (c *cmaes) update(results ceResultList) float64 {
+	c.generation++
+	// Steps of the best candidates from the old mean, in units of sigma.
+	ys := make([][]float64, c.mu)
+	yw := make([]float64, c.n)
+	var meanLines float64
+	for k := range ys {
+		ys[k] = make([]float64, c.n)
+		for i := range ys[k] {
+			ys[k][i] = (results[k].strategy[i] - c.m[i]) / c.sigma
+			yw[i] += c.weights[k] * ys[k][i]
+		}
+		meanLines += results[k].lines
+	}
+	meanLines /= float64(c.mu)
+	for i := range c.m {
+		c.m[i] += c.sigma * yw[i]
+	}
+
+	// Step size path, using cov^-1/2 * yw = b * diag(1/d) * b^T * yw.
+	bt := make([]float64, c.n)
+	for j := range bt {
+		for i := range yw {
+			bt[j] += c.b[i][j] * yw[i]
+		}
+		bt[j] /= c.d[j]
+	}
+	norm := math.Sqrt(c.cSigma * (2 - c.cSigma) * c.muEff)
+	var psNorm float64
+	for i := range c.ps {
+		var v float64
+		for j := range bt {
+			v += c.b[i][j] * bt[j]
+		}
+		c.ps[i] = (1-c.cSigma)*c.ps[i] + norm*v
+		psNorm += c.ps[i] * c.ps[i]
+	}
+	psNorm = math.Sqrt(psNorm)
+	var hSigma float64
+	if psNorm/math.Sqrt(1-math.Pow(1-c.cSigma, float64(2*c.generation))) < (1.4+2/float64(c.n+1))*c.chiN {
+		hSigma = 1
+	}
+
+	// Covariance path and matrix.
+	norm = math.Sqrt(c.cc * (2 - c.cc) * c.muEff)
+	for i := range c.pc {
+		c.pc[i] = (1-c.cc)*c.pc[i] + hSigma*norm*yw[i]
+	}
+	keep := 1 - c.c1 - c.cMu + (1-hSigma)*c.c1*c.cc*(2-c.cc)
+	for i := range c.cov {
+		for j := range c.cov[i] {
+			rankMu := 0.0
+			for k, y := range ys {
+				rankMu += c.weights[k] * y[i] * y[j]
+			}
+			c.cov[i][j] = keep*c.cov[i][j] + c.c1*c.pc[i]*c.pc[j] + c.cMu*rankMu
+		}
+	}
+	c.sigma *= math.Exp(c.cSigma / c.dSigma * (psNorm/c.chiN - 1))
+	c.decompose()
+	return meanLines
+}
+
+// decompose refreshes b and d from the covariance matrix.
+func (c *cmaes) decompose() {
+	values, vectors := symmetricEigen(c.cov)
+	c.b = vectors
+	c.d = make([]float64, c.n)
+	for i, v := range values {
+		c.d[i] = math.Sqrt(math.Max(v, 1e-20))
+	}
+}
+
+func (c *cmaes) mean() strategy { return c.m }
+
+func (c *cmaes) spread() []float64 {
+	spread := make([]float64, c.n)
+	for i := range spread {
+		spread[i] = c.sigma * c.sigma * c.cov[i][i]
+	}
+	return spread
+}
+
+func (c *cmaes) parents() int { return c.mu }
+
+// noiseAt returns the step size, which CMA-ES adapts on its own.
+func (c *cmaes) noiseAt(iteration int) float64 { return c.sigma }
+
+// cmaesState is the form a cmaes takes in checkpoints. Everything else is
+// derived from it.
+type cmaesState struct {
+	Lambda     int
+	Mean       strategy
+	Sigma      float64
+	Cov        [][]float64
+	Pc, Ps     []float64
+	Generation int
+}
+
+func (c *cmaes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cmaesState{c.lambda, c.m, c.sigma, c.cov, c.pc, c.ps, c.generation})
+}
+
+func (c *cmaes) UnmarshalJSON(data []byte) error {
+	var st cmaesState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	c.setup(len(st.Mean), st.Lambda)
+	c.m, c.sigma, c.cov, c.pc, c.ps, c.generation = st.Mean, st.Sigma, st.Cov, st.Pc, st.Ps, st.Generation
+	c.decompose()
+	return nil
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// symmetricEigen returns the eigenvalues of the symmetric matrix a and the
+// matching eigenvectors as the columns of a matrix, using the Jacobi
+// eigenvalue algorithm. It is slow for large matrices but the matrices here
+// only have one row per feature.
+func symmetricEigen(a [][]float64) ([]float64, [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = append([]float64(nil), a[i]...)
+	}
+	v := identity(n)
+	for sweep := 0; sweep < 100; sweep++ {
+		var off float64
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				off += m[i][j] * m[i][j]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if m[p][q] == 0 {
+					continue
+				}
+				// Rotate rows and columns p and q to zero out m[p][q].
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				cos := 1 / math.Sqrt(t*t+1)
+				sin := t * cos
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p], m[k][q] = cos*mkp-sin*mkq, sin*mkp+cos*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k], m[q][k] = cos*mpk-sin*mqk, sin*mpk+cos*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = cos*vkp-sin*vkq, sin*vkp+cos*vkq
+				}
+			}
+		}
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = m[i][i]
+	}
+	return values, v
+}
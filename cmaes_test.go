@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSymmetricEigenReconstructs(t *testing.T) {
+	a := [][]float64{
+		{4, 1, -2, 0.5},
+		{1, 3, 0, 1},
+		{-2, 0, 5, -1},
+		{0.5, 1, -1, 2},
+	}
+	values, vectors := symmetricEigen(a)
+	for i := range a {
+		for j := range a {
+			// a = V * diag(values) * V^T
+			var sum float64
+			for k := range values {
+				sum += vectors[i][k] * values[k] * vectors[j][k]
+			}
+			if math.Abs(sum-a[i][j]) > 1e-9 {
+				t.Errorf("reconstructed a[%d][%d] = %g, want %g", i, j, sum, a[i][j])
+			}
+		}
+	}
+	for k := range values {
+		// Eigenvectors are unit length.
+		var norm float64
+		for i := range a {
+			norm += vectors[i][k] * vectors[i][k]
+		}
+		if math.Abs(norm-1) > 1e-9 {
+			t.Errorf("eigenvector %d has squared length %g, want 1", k, norm)
+		}
+	}
+}
+
+func TestCMAESFindsQuadraticOptimum(t *testing.T) {
+	optimum := strategy{3, -2, 0.5, 7}
+	c := newCMAES(make(strategy, len(optimum)), 0)
+	random := rand.New(rand.NewSource(1))
+	for it := 1; it <= 300; it++ {
+		strats := c.candidates(random, it)
+		results := make(ceResultList, len(strats))
+		for i, s := range strats {
+			var dist float64
+			for j := range s {
+				dist += (s[j] - optimum[j]) * (s[j] - optimum[j])
+			}
+			results[i] = ceResult{strategy: s, score: -dist, lines: -dist}
+		}
+		sort.Sort(sort.Reverse(results))
+		c.update(results)
+	}
+	for i, m := range c.mean() {
+		if math.Abs(m-optimum[i]) > 1e-3 {
+			t.Errorf("mean[%d] = %g, want %g", i, m, optimum[i])
+		}
+	}
+}
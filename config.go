@@ -1,11 +1,263 @@
 package main
 
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
 const (
-	bWidth        = 10          // Board width
-	bHeight       = 10          // Board height
-	initRow       = bHeight - 1 // Piece's starting row
-	initCol       = 7           // Piece's starting column
+	// The widest and tallest boards the fixed-size arrays can hold. Boards
+	// and column heights are copied with every placement evaluated, so they
+	// are sized for the guideline board rather than anything larger.
+	maxWidth      = 10
+	maxHeight     = 20
+	minWidth      = formCols
+	minHeight     = pieceRows
 	iszForms      = 2
 	delaySideInit = 150
 	delayVertInit = 150
+	lockDelay     = 500 * time.Millisecond // Time a piece rests on the stack before gravity locks it
+)
+
+// Board geometry is chosen at startup. Everything derived from it is kept in
+// package variables so the hot path can keep indexing fixed-size arrays
+// without passing dimensions around.
+var (
+	bWidth  int // Board width
+	bHeight int // Board height
+	initRow int // Piece's starting row
+	initCol int // Piece's starting column
+)
+
+// Search settings, chosen at startup.
+var (
+	numPreview  int     // Number of upcoming pieces visible to the agent
+	searchDepth = 1     // Number of pieces placed per search, current included
+	searchPrune int     // Candidates expanded per ply, 0 expands all
+	searchRisk  float64 // Weight of the worst next piece at chance nodes
+	searchMode  = "greedy"
+	searchModes = []string{"greedy", "expectimax", "beam"}
+	beamWidth   = 1  // Boards kept per ply by beam search
+	beamBudget  int  // Thinking time per piece in ms for anytime beam search
+	holdEnabled bool // Whether the bot considers holding its piece
+	// Whether placements come from a full reachability search instead of the
+	// heightmap.
+	reachableSearch bool
+)
+
+var randomizerName = "uniform" // Piece generator used by every agent
+
+// Scoring settings, chosen at startup.
+var (
+	scoringName = "guideline"
+	startLevel  int
+	// Whether pieces fall on their own in the window, at the level's speed.
+	gravityEnabled = true
+)
+
+// Garbage settings, chosen at startup.
+var (
+	garbagePattern  string // Hole pattern of garbage rows, empty when disabled
+	garbageInterval int    // Pieces locked between batches of garbage
+	garbageBatch    int    // Rows of garbage per batch
+)
+
+// Evaluation settings, chosen at startup.
+var (
+	objective  = "lines" // What the optimizer maximizes
+	objectives = []string{"lines", "score", "attack"}
+	pieceLimit int // Pieces after which games played for evaluation end, 0 never ends them
+	// Whether candidates are scored by the result expected from their rate of
+	// topping out instead of the average result of their games.
+	survivalEstimate bool
+)
+
+// Attack settings, chosen at startup.
+var (
+	attackName  = "guideline"
+	attackRules = attackTables["guideline"] // Garbage sent by clears in versus matches
 )
+
+// Rotation settings, chosen at startup.
+var (
+	rotationName                = "simple"
+	rotationSys  rotationSystem = simpleRotation{}
+	allow180     bool           // Whether pieces can turn 180 degrees in one rotation
+	// Whether any piece rotated into a spot it cannot leave counts as a spin.
+	immobileSpins bool
+)
+
+func init() {
+	if err := setBoardSize(10, 10); err != nil {
+		panic(err)
+	}
+}
+
+// setBoardSize changes the board dimensions and rebuilds every value and
+// table that depends on them. It must be called before any agent is made.
+func setBoardSize(width, height int) error {
+	if width < minWidth || width > maxWidth {
+		return fmt.Errorf("board width must be between %d and %d, got %d", minWidth, maxWidth, width)
+	}
+	if height < minHeight || height > maxHeight {
+		return fmt.Errorf("board height must be between %d and %d, got %d", minHeight, maxHeight, height)
+	}
+	bWidth, bHeight = width, height
+	initRow = bHeight - 1
+	// Centers the piece's four-column frame, leaning left on odd widths.
+	initCol = (bWidth-3)/2 + formCols
+	numRows = bHeight + slab + rowsAbove
+	roof = slab + bHeight - 1
+	filledRow = uint64(1)<<bWidth - 1
+	walledRow = uint64(1)<<(bWidth+1) | 1
+	leftBorderRow = uint64(3) << bWidth
+	tableXStart, tableXStop = getXStartStop()
+	return nil
+}
+
+// setSearch chooses how many upcoming pieces are visible and how the bot
+// searches through them. The greedy and beam modes only search through known
+// pieces, while expectimax may search deeper than the preview by considering
+// every possible next piece.
+func setSearch(mode string, preview, depth, prune int, risk float64) error {
+	if preview < 0 {
+		return fmt.Errorf("preview length cannot be negative, got %d", preview)
+	}
+	maxDepth := preview + 1
+	switch mode {
+	case "greedy", "beam":
+	case "expectimax":
+		maxDepth = math.MaxInt32
+	default:
+		return fmt.Errorf("search mode must be one of %v, got %q", searchModes, mode)
+	}
+	if depth < 1 || depth > maxDepth {
+		return fmt.Errorf("search depth must be between 1 and %d for %s search, got %d", maxDepth, mode, depth)
+	}
+	if prune < 0 {
+		return fmt.Errorf("prune cannot be negative, got %d", prune)
+	}
+	if risk < 0 || risk > 1 {
+		return fmt.Errorf("risk must be between 0 and 1, got %g", risk)
+	}
+	searchMode, numPreview, searchDepth, searchPrune, searchRisk = mode, preview, depth, prune, risk
+	return nil
+}
+
+// setBeam sets how many boards beam search keeps per ply and the time budget
+// per piece in ms for anytime widening. A budget of 0 thinks for as long as
+// the bot waits between pieces.
+func setBeam(width, budget int) error {
+	if width < 1 {
+		return fmt.Errorf("beam width must be at least 1, got %d", width)
+	}
+	if budget < 0 {
+		return fmt.Errorf("beam budget cannot be negative, got %d", budget)
+	}
+	beamWidth, beamBudget = width, budget
+	return nil
+}
+
+// setRandomizer chooses the piece generator used by every agent. It must be
+// called after setSearch, which decides whether pieces are previewed.
+func setRandomizer(name string) error {
+	if _, ok := randomizers[name]; !ok {
+		return fmt.Errorf("unknown randomizer %q", name)
+	}
+	if name == "worst" && numPreview > 0 {
+		// Previewed pieces would be chosen against a board they never land on.
+		return fmt.Errorf("the worst randomizer cannot be used with a preview")
+	}
+	randomizerName = name
+	return nil
+}
+
+// setScoring chooses the scoring system used by every agent and the level it
+// starts on.
+func setScoring(name string, level int) error {
+	if _, ok := scoringSystems[name]; !ok {
+		return fmt.Errorf("unknown scoring system %q", name)
+	}
+	if level < 0 {
+		return fmt.Errorf("starting level cannot be negative, got %d", level)
+	}
+	scoringName, startLevel = name, level
+	return nil
+}
+
+// setGarbage chooses the hole pattern of garbage pushed into every agent's
+// board, along with a batch of rows pushed every interval pieces. An empty
+// pattern disables garbage.
+func setGarbage(pattern string, interval, rows int) error {
+	if pattern == "" {
+		garbagePattern = ""
+		return nil
+	}
+	if _, ok := garbagePatterns[pattern]; !ok {
+		return fmt.Errorf("unknown garbage pattern %q", pattern)
+	}
+	if interval < 1 {
+		return fmt.Errorf("garbage interval must be at least 1, got %d", interval)
+	}
+	if rows < 1 || rows > bHeight {
+		return fmt.Errorf("garbage rows must be between 1 and %d, got %d", bHeight, rows)
+	}
+	garbagePattern, garbageInterval, garbageBatch = pattern, interval, rows
+	return nil
+}
+
+func setObjective(name string) error {
+	for _, o := range objectives {
+		if o == name {
+			objective = name
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown objective %q, must be one of %v", name, objectives)
+}
+
+// setPieceLimit sets how many pieces evaluation games last and whether their
+// results are scored by the survival estimate, which needs a limit to be
+// useful.
+func setPieceLimit(limit int, survival bool) error {
+	if limit < 0 {
+		return fmt.Errorf("piece limit cannot be negative, got %d", limit)
+	}
+	if survival && limit == 0 {
+		return fmt.Errorf("survival estimates need a piece limit")
+	}
+	pieceLimit, survivalEstimate = limit, survival
+	return nil
+}
+
+// setAttack chooses the attack table used in versus matches, either by name
+// or as comma separated rows sent per line clear.
+func setAttack(name string) error {
+	t, err := parseAttackTable(name)
+	if err != nil {
+		return err
+	}
+	attackName, attackRules = name, t
+	return nil
+}
+
+// setRotation chooses the rotation system used by the human controls and the
+// reachability search, and whether 180 rotations are allowed.
+func setRotation(name string, with180 bool) error {
+	rs, ok := rotationSystems[name]
+	if !ok {
+		return fmt.Errorf("unknown rotation system %q", name)
+	}
+	rotationName, rotationSys, allow180 = name, rs, with180
+	return nil
+}
+
+// rotationDeltas returns the rotations a piece may make, in quarter turns
+// clockwise.
+func rotationDeltas() []int {
+	if allow180 {
+		return []int{1, -1, 2}
+	}
+	return []int{1, -1}
+}
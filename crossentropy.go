@@ -1,14 +1,10 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
 	"math"
 	"math/rand"
 	"os"
-	"runtime"
-	"sort"
-	"strings"
-	"time"
 )
 
 // crossEntropy implements the noisy cross entropy method to optimize weights
@@ -24,74 +20,66 @@ import (
 //
 // 3) Noise decreases logarithmically with the number of iterations.
 type crossEntropy struct {
-	means, variances, bestStratSingle, bestStratMean     strategy
-	population, iterations, cutoff, numOfGames           int
-	rho, noise, bestResultSingle, bestResultMean, lambda float64
+	means, variances   strategy
+	population, cutoff int
+	rho, noise         float64
 }
 
-func (s strategy) newCrossEntropy(numOfGames int) crossEntropy {
-	return crossEntropy{
-		means:      s,
-		variances:  initVariances(len(s), 10),
-		population: 100,
+func newCrossEntropy(start strategy, population int) optimizer {
+	if population == 0 {
+		population = 100
+	}
+	ce := &crossEntropy{
+		means:      start,
+		variances:  initVariances(len(start), 10),
+		population: population,
 		noise:      0.03,
-		rho:        0.1,                    // Top percent of population to consider
-		lambda:     0.04 / float64(len(s)), // L1 regularization constant
-		numOfGames: numOfGames,
+		rho:        0.1, // Top percent of population to consider
 	}
+	ce.cutoff = int(ce.rho * float64(ce.population))
+	return ce
 }
 
-func (ce *crossEntropy) run() {
-	ce.cutoff = int(ce.rho * float64(ce.population))
-	for {
-		ce.iterations++
-		// Get a new set of strategies
-		strats := make([]strategy, ce.population)
-		for i := 0; i < ce.population; i++ {
-			strats[i] = ce.getStrat()
-		}
-		results := ce.testStrategies(strats)
-		sort.Sort(sort.Reverse(results))
-		ce.updateMeansAndVariances(results)
-		ce.logData(results)
+func (ce *crossEntropy) candidates(random *rand.Rand, iteration int) []strategy {
+	strats := make([]strategy, ce.population)
+	for i := range strats {
+		strats[i] = ce.getStrat(random, iteration)
 	}
+	return strats
 }
 
-// testStrats takes a slice of strategies, plays them out in parallel, and then
-// returns a slice of strategy-result pairs.
-func (ce *crossEntropy) testStrategies(strats []strategy) ceResultList {
-	jobs := make(chan int, len(strats))
-	resultChan := make(chan ceResult, len(strats))
-	results := make(ceResultList, len(strats))
-	for i := 0; i < len(strats); i++ {
-		jobs <- i
-	}
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go ceWorker(jobs, resultChan, strats, ce.numOfGames, ce.lambda)
-	}
-	close(jobs)
-	for i := 0; i < len(strats); i++ {
-		r := <-resultChan
-		results[i] = r
-	}
-	return results
+func (ce *crossEntropy) mean() strategy    { return ce.means }
+func (ce *crossEntropy) spread() []float64 { return ce.variances }
+func (ce *crossEntropy) parents() int      { return ce.cutoff }
+
+// noiseAt returns the noise factor, which decreases logarithmically with the
+// number of iterations.
+func (ce *crossEntropy) noiseAt(iteration int) float64 {
+	return ce.noise * 1 / (math.Log10(1 + float64(iteration)))
+}
+
+// ceJobResult is the result of the strategy at index in a ceWorker's jobs.
+type ceJobResult struct {
+	index int
+	ceResult
 }
 
 // ceWorker runs with other workers, who share a pool of jobs to process games
-// concurrently.
-func ceWorker(jobs <-chan int, results chan<- ceResult, strats []strategy, numOfGames int, lambda float64) {
+// concurrently. Every strategy plays a game on each of seeds.
+func ceWorker(jobs <-chan int, results chan<- ceJobResult, strats []strategy, seeds []int64, lambda float64) {
+	games := make([]float64, len(seeds))
+	toppedOut := make([]bool, len(seeds))
 	for i := range jobs {
-		var total float64
-		for j := 0; j < numOfGames; j++ {
-			_, lines := makeAgent(strats[i], int64(j), 0).run()
-			total += float64(lines)
+		for j, seed := range seeds {
+			games[j], toppedOut[j] = gameResult(strats[i], seed)
 		}
-		average := total / float64(numOfGames)
-		results <- ceResult{
+		average := expectedResult(games, toppedOut)
+		results <- ceJobResult{i, ceResult{
 			strategy: strats[i],
 			score:    average - l1Regularization(average, lambda, strats[i]),
 			lines:    average,
-		}
+			games:    len(seeds),
+		}}
 	}
 }
 
@@ -106,18 +94,18 @@ func l1Regularization(lines, lambda float64, strat strategy) float64 {
 	return lambda * lines * penalty
 }
 
-func (ce *crossEntropy) getStrat() strategy {
-	noise := ce.noise * 1 / (math.Log10(1 + float64(ce.iterations)))
+func (ce *crossEntropy) getStrat(random *rand.Rand, iteration int) strategy {
+	noise := ce.noiseAt(iteration)
 	candidate := make(strategy, len(ce.means))
 	for i := 0; i < len(ce.means); i++ {
 		// Generate strategy based on mean and variance and add noise
 		variance := math.Abs(ce.means[i])*noise + ce.variances[i]
-		candidate[i] = rand.NormFloat64()*math.Sqrt(variance) + ce.means[i]
+		candidate[i] = random.NormFloat64()*math.Sqrt(variance) + ce.means[i]
 	}
 	return candidate
 }
 
-func (ce *crossEntropy) updateMeansAndVariances(results ceResultList) {
+func (ce *crossEntropy) update(results ceResultList) float64 {
 	weights := make([][]float64, len(ce.means))
 	var meanLines float64
 	for i := 0; i < len(ce.means); i++ {
@@ -125,43 +113,37 @@ func (ce *crossEntropy) updateMeansAndVariances(results ceResultList) {
 		for j := 0; j < ce.cutoff; j++ {
 			weights[i][j] = results[j].strategy[i]
 		}
-		meanLines += results[i].lines
 	}
-	meanLines /= float64(len(ce.means))
+	for j := 0; j < ce.cutoff; j++ {
+		meanLines += results[j].lines
+	}
+	meanLines /= float64(ce.cutoff)
 	for i := 0; i < len(ce.means); i++ {
 		ce.means[i] = getMean(weights[i])
 		ce.variances[i] = getVariance(weights[i], ce.means[i])
 	}
-	if meanLines > ce.bestResultMean {
-		ce.bestResultMean = meanLines
-		ce.bestStratMean = ce.means
-	}
+	return meanLines
 }
 
-func (ce *crossEntropy) logData(results ceResultList) {
-	var sb strings.Builder
-	for i := 0; i < len(results); i++ {
-		if results[i].lines > ce.bestResultSingle {
-			ce.bestResultSingle = results[i].lines
-			ce.bestStratSingle = results[i].strategy
-			stars := strings.Repeat("*", 30)
-			sb.WriteString(fmt.Sprintf(stars + " New Best " + stars + "\n"))
-		}
-	}
-	strFormat := "%12.0f : "
-	sb.WriteString(fmt.Sprintf(strFormat, ce.bestResultMean) + ce.bestStratMean.string() + " Best average\n")
-	sb.WriteString(fmt.Sprintf(strFormat, ce.bestResultSingle) + ce.bestStratSingle.string() + " Best single\n\n")
-	for i := 0; i < ce.cutoff; i++ {
-		lines := results[i].lines
-		sb.WriteString(fmt.Sprintf(strFormat, lines))
-		sb.WriteString(results[i].strategy.string() + "\n")
+// ceState is the form a crossEntropy takes in checkpoints.
+type ceState struct {
+	Means, Variances strategy
+	Population       int
+	Rho, Noise       float64
+}
+
+func (ce *crossEntropy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ceState{ce.means, ce.variances, ce.population, ce.rho, ce.noise})
+}
+
+func (ce *crossEntropy) UnmarshalJSON(data []byte) error {
+	var st ceState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
 	}
-	t := time.Now().Format("2006-01-02 15:04:05")
-	info := fmt.Sprintf("%d game(s) per trial\t %dx%d board", ce.numOfGames, bWidth, bHeight)
-	sb.WriteString(fmt.Sprintf("\nIteration %d\t%s\t%s\n\n", ce.iterations, t, info))
-	str := sb.String()
-	fmt.Print(str)
-	writeToFile(str, "ce.txt")
+	ce.means, ce.variances, ce.population, ce.rho, ce.noise = st.Means, st.Variances, st.Population, st.Rho, st.Noise
+	ce.cutoff = int(ce.rho * float64(ce.population))
+	return nil
 }
 
 func initVariances(size int, variance float64) []float64 {
@@ -175,13 +157,23 @@ func initVariances(size int, variance float64) []float64 {
 type ceResult struct {
 	strategy
 	score, lines float64
+	games        int // Games played, fewer than the rest when dropped from a race
 }
 
+// ceResultList orders results by score, except that results over fewer games,
+// such as those dropped from a race, come before the rest. Their scores are not
+// comparable.
 type ceResultList []ceResult
 
-func (p ceResultList) Len() int           { return len(p) }
-func (p ceResultList) Less(i, j int) bool { return p[i].score < p[j].score }
-func (p ceResultList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p ceResultList) Len() int      { return len(p) }
+func (p ceResultList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p ceResultList) Less(i, j int) bool {
+	if p[i].games != p[j].games {
+		return p[i].games < p[j].games
+	}
+	return p[i].score < p[j].score
+}
 
 func getMean(data []float64) float64 {
 	var sum float64
@@ -201,7 +193,7 @@ func getVariance(data []float64, mean float64) float64 {
 }
 
 func writeToFile(str, file string) {
-	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE, 0600)
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
 	if err != nil {
 		panic(err)
 	}
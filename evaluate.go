@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+)
+
+// gameResult plays one game with strat on seed and returns what the
+// optimizer maximizes, and whether the game topped out before the piece limit.
+// By default that is lines cleared, or garbage cleared when garbage is on.
+// Scoring and attack objectives reward the combos and back-to-back clears that
+// lines alone do not.
+func gameResult(strat strategy, seed int64) (float64, bool) {
+	a := makeAgent(strat, seed, 0).run(pieceLimit)
+	switch objective {
+	case "score":
+		return float64(a.scorer.score()), a.gameOver
+	case "attack":
+		return float64(a.sent), a.gameOver
+	}
+	if garbagePattern != "" {
+		// Downstacking is judged by garbage cleared rather than lines.
+		return float64(a.totalGarbage), a.gameOver
+	}
+	return float64(a.totalLines), a.gameOver
+}
+
+// playSeeds plays strat on every seed in parallel and returns the results, and
+// whether each game topped out, in the order of seeds.
+func playSeeds(strat strategy, seeds []int64) ([]float64, []bool) {
+	jobs := make(chan int, len(seeds))
+	done := make(chan struct{}, len(seeds))
+	results := make([]float64, len(seeds))
+	toppedOut := make([]bool, len(seeds))
+	for i := range seeds {
+		jobs <- i
+	}
+	close(jobs)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for j := range jobs {
+				results[j], toppedOut[j] = gameResult(strat, seeds[j])
+				done <- struct{}{}
+			}
+		}()
+	}
+	for range seeds {
+		<-done
+	}
+	return results, toppedOut
+}
+
+// expectedResult is the score of a candidate's games: their average result,
+// or the survival estimate when that is enabled.
+func expectedResult(results []float64, toppedOut []bool) float64 {
+	if survivalEstimate {
+		return survivalResult(results, toppedOut)
+	}
+	return getMean(results)
+}
+
+// survivalResult estimates the expected result of games that may have been
+// cut short by the piece limit. Topping out is taken to be equally likely on
+// every piece, which makes the expected game length the pieces played per game
+// that topped out. As the result grows in step with the pieces, the expected
+// result is then the total result per game that topped out. Half a top-out is
+// added so that the estimate stays finite when no game topped out, while
+// staying above the estimate for when one did. The estimate grows with the
+// evidence of survival, so only estimates over the same games should be
+// compared.
+func survivalResult(results []float64, toppedOut []bool) float64 {
+	var total, ends float64
+	for i, r := range results {
+		total += r
+		if toppedOut[i] {
+			ends++
+		}
+	}
+	return total / (ends + 0.5)
+}
+
+// First seed of the held-out set, far from the seeds used for training.
+const heldOutSeed = 1 << 32
+
+// heldOutSeeds returns n seeds that are never used for training.
+func heldOutSeeds(n int) []int64 {
+	seeds := make([]int64, n)
+	for i := range seeds {
+		seeds[i] = heldOutSeed + int64(i)
+	}
+	return seeds
+}
+
+// summary describes a sample of game results.
+type summary struct {
+	n                    int
+	mean, median, stdErr float64
+	low, high            float64 // 95% confidence interval of the mean
+}
+
+func summarize(results []float64) summary {
+	s := summary{n: len(results)}
+	if s.n == 0 {
+		return s
+	}
+	sorted := append([]float64(nil), results...)
+	sort.Float64s(sorted)
+	s.mean = getMean(sorted)
+	if s.n%2 == 1 {
+		s.median = sorted[s.n/2]
+	} else {
+		s.median = (sorted[s.n/2-1] + sorted[s.n/2]) / 2
+	}
+	if s.n > 1 {
+		s.stdErr = math.Sqrt(getVariance(sorted, s.mean) / float64(s.n))
+	}
+	s.low, s.high = s.mean-1.96*s.stdErr, s.mean+1.96*s.stdErr
+	return s
+}
+
+func (s summary) String() string {
+	return fmt.Sprintf("%d games: mean %.1f, median %.1f, standard error %.1f, 95%% interval %.1f to %.1f",
+		s.n, s.mean, s.median, s.stdErr, s.low, s.high)
+}
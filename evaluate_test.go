@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSurvivalResult(t *testing.T) {
+	tests := []struct {
+		results   []float64
+		toppedOut []bool
+		want      float64
+	}{
+		// Even when every game topped out, the added half top-out puts the
+		// estimate below the average of 200.
+		{[]float64{100, 200, 300}, []bool{true, true, true}, 600 / 3.5},
+		// Half a top-out is added when none happened.
+		{[]float64{100, 100}, []bool{false, false}, 200 / 0.5},
+		{[]float64{100, 100}, []bool{true, false}, 200 / 1.5},
+	}
+	for _, tt := range tests {
+		if got := survivalResult(tt.results, tt.toppedOut); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("survivalResult(%v, %v) = %g, want %g", tt.results, tt.toppedOut, got, tt.want)
+		}
+	}
+	none := survivalResult([]float64{100, 100}, []bool{false, false})
+	one := survivalResult([]float64{100, 100}, []bool{true, false})
+	if none <= one {
+		t.Errorf("no top-outs scored %g, not above one top-out at %g", none, one)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := summarize([]float64{4, 1, 3, 2})
+	if s.n != 4 || s.mean != 2.5 || s.median != 2.5 {
+		t.Errorf("got n %d, mean %g, median %g, want 4, 2.5, 2.5", s.n, s.mean, s.median)
+	}
+	// Sample variance 5/3, so the standard error is sqrt(5/12).
+	stdErr := math.Sqrt(5.0 / 12)
+	if math.Abs(s.stdErr-stdErr) > 1e-9 {
+		t.Errorf("standard error %g, want %g", s.stdErr, stdErr)
+	}
+	if math.Abs(s.low-(2.5-1.96*stdErr)) > 1e-9 || math.Abs(s.high-(2.5+1.96*stdErr)) > 1e-9 {
+		t.Errorf("interval %g to %g, want 2.5 ± %g", s.low, s.high, 1.96*stdErr)
+	}
+	if odd := summarize([]float64{5, 1, 9}); odd.median != 5 {
+		t.Errorf("median of 5, 1, 9 is %g, want 5", odd.median)
+	}
+	if single := summarize([]float64{7}); single.stdErr != 0 || single.low != 7 {
+		t.Errorf("single result gave standard error %g and low %g, want 0 and 7", single.stdErr, single.low)
+	}
+}
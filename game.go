@@ -9,21 +9,38 @@ import (
 type agent struct {
 	signal
 	strategy
-	random   *rand.Rand
+	random   randomizer
+	garbage  garbageGenerator // Nil unless garbage is enabled
+	scorer   scoringSystem
+	preview  []int // Upcoming pieces, next piece first
+	sent     int   // Garbage rows its clears would send by the attack table
 	gameOver bool
 	speed    int
 }
 
 // signal stores things to be considered for evaluation. The variable summit is
-// the highest, non-empty row.
+// the highest, non-empty row. The variable hold is the held piece, or noPiece
+// when nothing is held, and holdUsed stops a piece from being held twice
+// before it locks. The variable combo counts consecutive clearing locks after
+// the first, and backToBack counts consecutive difficult clears (tetrises and
+// spins) after the first. Either is -1 once its chain is broken. The variable
+// garbageRows is how many garbage rows are left on the board and
+// totalGarbage how many have been cleared.
 type signal struct {
 	board
 	pos
-	colHeights                             [bWidth]int
+	colHeights                             [maxWidth]int
 	summit, lines, totalLines, totalPieces int
+	spin                                   int // Spin kind of the last lock
+	combo, backToBack                      int
+	garbageRows, totalGarbage              int
+	hold                                   int
+	holdUsed                               bool
 	gameOver                               bool
 }
 
+const noPiece = -1
+
 type strategy []float64
 
 // pos stores the type of piece as well as it's orientation and x, y
@@ -35,12 +52,21 @@ type strategy []float64
 // of the playfield.
 // Note: x increases from left to right while column indexes (such as those in
 // colHeights) start at 0 and increase from right to left.
+// lastMove records how the piece got to this position, which decides whether
+// locking it counts as a spin.
 type pos struct {
-	piece, form, y, x int
+	piece, form, y, x, lastMove int
 }
 
+// Ways a piece can have last moved.
+const (
+	moveDrop   = iota // Spawned, shifted or dropped
+	moveRotate        // Rotated
+	moveKick          // Rotated with a kick that always counts as a full spin
+)
+
 func defaultPos(piece int) pos {
-	return pos{piece, 0, initRow, initCol}
+	return pos{piece, 0, initRow, initCol, moveDrop}
 }
 
 const formCols = 4
@@ -52,11 +78,14 @@ func (p pos) pieceBits(row int) uint64 {
 	return pieces[p.piece] >> (p.form*formCells + row*formCols) & pieceMask << bWidth >> p.x
 }
 
-const filledRow = 1<<bWidth - 1
+var filledRow uint64 // Set by setBoardSize
 const pieceFilledCells = 4
 
 // inBounds checks if the piece is inside the borders.
 func (p pos) inBounds() bool {
+	if p.x < 0 {
+		return false // Avoids shifting by a negative amount.
+	}
 	var filled int
 	for i := 0; i < pieceRows; i++ {
 		filled += bits.OnesCount64(p.pieceBits(i) & filledRow)
@@ -80,11 +109,13 @@ func (p pos) inBounds() bool {
 
 func (p pos) move(delta int) pos {
 	p.x += delta
+	p.lastMove = moveDrop
 	return p
 }
 
 func (p pos) descend(delta int) pos {
 	p.y -= delta
+	p.lastMove = moveDrop
 	return p
 }
 
@@ -92,6 +123,7 @@ const numForms = 4
 
 func (p pos) rotate(delta int) pos {
 	p.form = ((p.form+delta)%numForms + numForms) %	numForms
+	p.lastMove = moveRotate
 	return p
 }
 
@@ -119,7 +151,7 @@ func (p pos) instantDescend(delta int, b board) pos {
 
 // updateColHeights checks and updates the highest filled row for each column.
 // This method saves work by reducing the row index's upper bound.
-func updateColHeights(b board, colHeights [bWidth]int, p pos, lines int) [bWidth]int {
+func updateColHeights(b board, colHeights [maxWidth]int, p pos, lines int) [maxWidth]int {
 	// Upper bound for column overlapped by piece is the topHeight or
 	// old colHeight, whichever is higher (old colHeight can be higher when
 	// softdropping and sliding piece underneath an overhang).
@@ -145,26 +177,90 @@ func updateColHeights(b board, colHeights [bWidth]int, p pos, lines int) [bWidth
 // lock merges the piece and updates important information
 func (s signal) lock(p pos) signal {
 	s.pos = p
+	s.spin = s.spinOf(s.pos)
 	s.board = s.merge(s.pos)
+	if s.garbageRows > 0 {
+		cleared := s.clearedGarbage(s.pos)
+		s.garbageRows -= cleared
+		s.totalGarbage += cleared
+	}
 	s.board, s.summit, s.lines = s.clearLines(s.pos, s.summit)
 	s.colHeights = updateColHeights(s.board, s.colHeights, s.pos, s.lines)
 	s.totalLines += s.lines
 	s.totalPieces++
+	if s.lines > 0 {
+		s.combo++
+		// Non-clearing locks keep a back-to-back chain alive.
+		if s.lines == 4 || s.spin != noSpin {
+			s.backToBack++
+		} else {
+			s.backToBack = -1
+		}
+	} else {
+		s.combo = -1
+	}
+	s.holdUsed = false
 	s.gameOver = s.isGameOver()
 	return s
 }
 
 func (a agent) lockAndNewPiece() agent {
 	a.signal = a.lock(a.pos)
-	a.pos = defaultPos(a.random.Intn(numPieces))
+	a.scorer.lock(a.signal)
+	a.sent += attackRules.attack(a.signal)
+	if a.garbage != nil && a.totalPieces%garbageInterval == 0 {
+		a.signal = a.pushGarbage(a.garbage.holes(garbageBatch))
+		// Garbage pushing the stack out the top ends the game.
+		a.gameOver = a.gameOver || a.signal.gameOver
+	}
+	a.pos = defaultPos(a.nextPiece())
 	return a
 }
+
+// holdPiece swaps the active piece with the held piece, or with the next
+// piece if nothing is held yet. A piece can only be held once before locking.
+func (a agent) holdPiece() agent {
+	if a.holdUsed {
+		return a
+	}
+	next := a.hold
+	if next == noPiece {
+		next = a.nextPiece()
+	}
+	a.hold = a.piece
+	a.holdUsed = true
+	a.pos = defaultPos(next)
+	return a
+}
+
+// nextPiece takes the next piece from the front of the preview and pushes a
+// new one onto the back.
+func (a *agent) nextPiece() int {
+	next := a.random.next(a.signal, a.strategy)
+	if len(a.preview) > 0 {
+		queued := a.preview[0]
+		copy(a.preview, a.preview[1:])
+		a.preview[len(a.preview)-1] = next
+		next = queued
+	}
+	return next
+}
+
 func makeAgent(strat strategy, seed int64, speed int) agent {
-	r := rand.New(rand.NewSource(seed))
-	return agent{
-		signal:   signal{pos: defaultPos(r.Intn(numPieces)), summit: slab},
+	a := agent{
+		signal:   signal{summit: slab, hold: noPiece, combo: -1, backToBack: -1},
 		strategy: strat,
-		random:   r,
+		random:   randomizers[randomizerName](rand.New(rand.NewSource(seed))),
+		scorer:   scoringSystems[scoringName](startLevel),
+		preview:  make([]int, numPreview),
 		speed:    speed,
 	}
+	if garbagePattern != "" {
+		a.garbage = garbagePatterns[garbagePattern](rand.New(rand.NewSource(garbageSeed(seed))))
+	}
+	a.pos = defaultPos(a.random.next(a.signal, a.strategy))
+	for i := range a.preview {
+		a.preview[i] = a.random.next(a.signal, a.strategy)
+	}
+	return a
 }
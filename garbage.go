@@ -0,0 +1,98 @@
+package main
+
+import "math/rand"
+
+// garbageGenerator decides where the hole goes in each garbage row pushed
+// into the bottom of an agent's board.
+type garbageGenerator interface {
+	// holes returns the column of the hole in each of n new rows, bottom row
+	// first.
+	holes(n int) []int
+}
+
+// garbagePatterns maps each hole pattern's name to a constructor taking the
+// source of randomness it draws from.
+var garbagePatterns = map[string]func(*rand.Rand) garbageGenerator{
+	"clean":  func(r *rand.Rand) garbageGenerator { return &holeGenerator{random: r, stay: 1} },
+	"messy":  func(r *rand.Rand) garbageGenerator { return &holeGenerator{random: r, stay: messyStay} },
+	"cheese": func(r *rand.Rand) garbageGenerator { return &holeGenerator{random: r, stay: 0} },
+}
+
+// garbageSeed derives the seed of a garbage generator from the seed of a game,
+// so that holes are not drawn from the same stream as the game's pieces.
+func garbageSeed(seed int64) int64 {
+	return seed ^ 0x2545F4914F6CDD1D
+}
+
+// Chance that a messy garbage row keeps the hole of the row below it.
+const messyStay = 0.7
+
+// holeGenerator starts every batch of garbage with a hole in a random column.
+// Each row after the first keeps the hole of the row below it with chance
+// stay, or else moves it to a different random column. Clean garbage always
+// keeps it, giving one well per batch, while cheese never does.
+type holeGenerator struct {
+	random *rand.Rand
+	stay   float64
+}
+
+func (h *holeGenerator) holes(n int) []int {
+	holes := make([]int, n)
+	for i := range holes {
+		if i > 0 && h.random.Float64() < h.stay {
+			holes[i] = holes[i-1]
+			continue
+		}
+		holes[i] = h.random.Intn(bWidth)
+		if i > 0 && holes[i] == holes[i-1] {
+			// Pick among the other columns so the hole always moves.
+			holes[i] = (holes[i] + 1 + h.random.Intn(bWidth-1)) % bWidth
+		}
+	}
+	return holes
+}
+
+// pushGarbage pushes one filled row into the bottom of the board for each
+// hole, leaving the hole's column empty. The stack is shifted up, so rows
+// pushed past the roof end the game.
+func (s signal) pushGarbage(holes []int) signal {
+	n := len(holes)
+	if n == 0 {
+		return s
+	}
+	for i := min(s.summit, maxRows-1-n); i >= slab; i-- {
+		s.board[i+n] = s.board[i]
+	}
+	for i, col := range holes {
+		s.board[slab+i] = filledRow &^ (1 << col)
+	}
+	s.garbageRows += n
+	top := min(s.summit+n, maxRows-1)
+	s.summit = slab
+	for col := 0; col < bWidth; col++ {
+		var height int
+		for row := top; row >= slab; row-- {
+			if s.board[row]>>col&1 != 0 {
+				height = row - slab + 1
+				break
+			}
+		}
+		s.colHeights[col] = height
+		s.summit = max(s.summit, slab+height-1)
+	}
+	s.gameOver = s.isGameOver()
+	return s
+}
+
+// clearedGarbage counts the rows of garbage that the piece at p fills. Garbage
+// only enters from the bottom and clears from anywhere, so what is left of it
+// always sits in the bottom garbageRows rows.
+func (s signal) clearedGarbage(p pos) int {
+	var cleared int
+	for row := p.y; row < p.y+pieceRows && row < slab+s.garbageRows; row++ {
+		if row >= slab && s.board[row] == filledRow {
+			cleared++
+		}
+	}
+	return cleared
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,12 +15,121 @@ var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	botGo      = flag.Int("b", -1, "run bot with specified speed in ms. 0 plays without rendering.")
 	optimize   = flag.Int("o", 0, "run strategy optimization with a specified number of games per trial")
+	width      = flag.Int("width", 10, "board width")
+	height     = flag.Int("height", 10, "board height")
+	preview    = flag.Int("preview", 0, "number of upcoming pieces visible in the next queue")
+	depth      = flag.Int("depth", 1, "number of pieces the bot searches through, current piece included")
+	search     = flag.String("search", "greedy", "search mode: greedy and beam search known pieces only, expectimax averages over unknown ones")
+	prune      = flag.Int("prune", 0, "number of best-looking placements expanded per ply. 0 expands all.")
+	risk       = flag.Float64("risk", 0, "weight from 0 to 1 given to the worst unknown piece instead of the average")
+	beam       = flag.Int("beam", 8, "number of boards beam search keeps per ply")
+	budget     = flag.Int("budget", 0, "thinking time per piece in ms for beam search to keep widening. 0 uses the bot speed.")
+	hold       = flag.Bool("hold", false, "let the bot hold its piece")
+	reachable  = flag.Bool("reachable", false, "find placements by searching every reachable position, including tucks and spins")
+	rotation   = flag.String("rotation", "simple", "rotation system: simple turns in place, srs adds wall kicks")
+	rotate180  = flag.Bool("180", false, "allow 180 degree rotations")
+	allSpin    = flag.Bool("allspin", false, "count any piece rotated into a spot it cannot leave as a spin")
+	scoring    = flag.String("scoring", "guideline", "scoring system: nes, guideline with combos and back-to-back, or tgm")
+	level      = flag.Int("level", 0, "starting level, which sets how fast pieces fall")
+	gravity    = flag.Bool("gravity", true, "make pieces fall on their own when playing in the window")
+	stratFile  = flag.String("strategy", "", "load the strategy for bot play, hints and the optimizer's starting point from a JSON file")
+	saveFile   = flag.String("save", "", "save the optimizer's best average strategy to a JSON file whenever it improves")
+	seed       = flag.Int64("seed", -1, "master seed making an optimizer run reproducible. -1 picks one from the clock.")
+	optName    = flag.String("optimizer", "ce", "optimizer: ce for noisy cross entropy, or cmaes")
+	population = flag.Int("population", 0, "candidates per optimizer iteration. 0 uses the optimizer's default.")
+	checkpoint = flag.String("checkpoint", "ce_checkpoint.json", "file the optimizer saves its state to after every iteration. A new run will not replace an existing one. Empty disables checkpoints.")
+	logFile    = flag.String("log", "ce.txt", "file the optimizer appends its text log to. Empty disables it.")
+	jsonLog    = flag.String("jsonlog", "ce.jsonl", "file the optimizer appends a JSON record of every iteration to. A new run will not add to an existing one. Empty disables it.")
+	plot       = flag.String("plot", "", "print the JSON log of an optimizer run as CSV for charting")
+	resume     = flag.Bool("resume", false, "continue the optimizer run saved in the checkpoint file")
+	maxIter    = flag.Int("maxiter", 0, "stop the optimizer after this many iterations. 0 never stops.")
+	minVar     = flag.Float64("minvar", 0, "stop the optimizer once every weight's variance falls below this")
+	patience   = flag.Int("patience", 0, "stop the optimizer after this many iterations without a better average")
+	timeLimit  = flag.Duration("timelimit", 0, "stop the optimizer after running this long, such as 12h")
+	goal       = flag.String("objective", "lines", "what the optimizer maximizes: lines (garbage cleared when garbage is on), score from the scoring system, or attack sent by the attack table")
+	maxPieces  = flag.Int("pieces", 0, "end games played by the bot and optimizer after this many pieces. 0 plays until the game ends.")
+	survival   = flag.Bool("survival", false, "score optimizer candidates by the lines expected from how often their games top out before the piece limit")
+	race       = flag.Bool("race", false, "play optimizer candidates in rounds, dropping those unlikely to make the cutoff before they play every game")
+	heldOut    = flag.Int("holdout", 1000, "games on held-out seeds used to report the final strategy when the optimizer stops")
+	chains     = flag.Bool("chains", false, "weigh combo and back-to-back chains, adding two weights for the optimizer to tune")
+	garbage    = flag.String("garbage", "", "push garbage rows into the board with holes placed by pattern: clean, messy, or cheese")
+	garbageGap = flag.Int("garbagerate", 5, "pieces locked between batches of garbage")
+	garbageRun = flag.Int("garbagerows", 1, "rows of garbage per batch")
+	versus     = flag.Int("versus", 0, "play a number of versus matches against the opponent without rendering")
+	watch      = flag.Int("watch", 0, "show a versus match against the opponent in the window with each piece taking the specified ms")
+	opponent   = flag.String("opponent", "", "strategy of the versus opponent, as a JSON file or comma separated weights. Empty plays the default strategy.")
+	attack     = flag.String("attack", "guideline", "versus attack table: guideline, classic, or rows sent by 1 to 4 lines such as 0,1,2,4")
+	pps        = flag.Float64("pps", 0, "play against the opponent bot in the window, which places this many pieces per second. 0 plays alone.")
+	shared     = flag.Bool("shared", false, "give the human and the opponent bot the same pieces")
+	tournament = flag.String("tournament", "", "play a round-robin versus tournament between the strategies listed in a file, one per line as [name:] weights")
+	rounds     = flag.Int("rounds", 10, "seeds each pair of strategies plays a tournament on, once from each side")
+	generator  = flag.String("randomizer", "uniform", "piece generator: uniform, bag, tgm, nes, or worst to always give the piece the bot handles worst")
 )
 
 // 113445.006 pps
 
 func main() {
 	flag.Parse()
+	if err := setBoardSize(*width, *height); err != nil {
+		log.Fatal(err)
+	}
+	if err := setSearch(*search, *preview, *depth, *prune, *risk); err != nil {
+		log.Fatal(err)
+	}
+	if err := setBeam(*beam, *budget); err != nil {
+		log.Fatal(err)
+	}
+	holdEnabled = *hold
+	reachableSearch = *reachable
+	immobileSpins = *allSpin
+	if err := setRandomizer(*generator); err != nil {
+		log.Fatal(err)
+	}
+	if err := setScoring(*scoring, *level); err != nil {
+		log.Fatal(err)
+	}
+	gravityEnabled = *gravity
+	if err := setGarbage(*garbage, *garbageGap, *garbageRun); err != nil {
+		log.Fatal(err)
+	}
+	if err := setObjective(*goal); err != nil {
+		log.Fatal(err)
+	}
+	if err := setPieceLimit(*maxPieces, *survival); err != nil {
+		log.Fatal(err)
+	}
+	if err := setAttack(*attack); err != nil {
+		log.Fatal(err)
+	}
+	if err := setRotation(*rotation, *rotate180); err != nil {
+		log.Fatal(err)
+	}
+	if *stratFile != "" {
+		strat, meta, err := loadStrategy(*stratFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if meta.Width != 0 && (meta.Width != bWidth || meta.Height != bHeight) {
+			log.Printf("%s was tuned on a %dx%d board, not %dx%d", *stratFile, meta.Width, meta.Height, bWidth, bHeight)
+		}
+		testStrat = strat
+	}
+	if *chains && len(testStrat) == numCoreFeatures {
+		testStrat = append(testStrat, make(strategy, numChainFeatures)...)
+	}
+	opponentStrat := testStrat
+	if *opponent != "" {
+		var err error
+		if strings.HasSuffix(*opponent, ".json") {
+			opponentStrat, _, err = loadStrategy(*opponent)
+		} else {
+			opponentStrat, err = parseStrategy(*opponent)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	stop := stopCriteria{*maxIter, *minVar, *patience, *timeLimit}
 	switch {
 	case *cpuprofile != "":
 		f, err := os.Create(*cpuprofile)
@@ -31,19 +142,91 @@ func main() {
 		var totalPieces int
 		now := time.Now()
 		for i := 0; i < 1; i++ {
-			p, _ := makeAgent(testStrat, int64(i), *botGo).run()
-			fmt.Println(p, "pieces")
-			totalPieces += p
+			a := makeAgent(testStrat, int64(i), *botGo).run(pieceLimit)
+			fmt.Println(a.totalPieces, "pieces")
+			if garbagePattern != "" {
+				fmt.Printf("%d garbage cleared, %.3f per piece\n", a.totalGarbage,
+					float64(a.totalGarbage)/float64(a.totalPieces))
+			}
+			totalPieces += a.totalPieces
 		}
 		elapsed := time.Since(now)
 		fmt.Println(elapsed, totalPieces, float64(totalPieces)/elapsed.Seconds())
+	case *versus > 0:
+		var wins [2]int
+		for i := 0; i < *versus; i++ {
+			winner := playMatch([2]strategy{testStrat, opponentStrat}, int64(i))
+			fmt.Printf("match %d: %s\n", i, describeResult(winner))
+			if winner >= 0 {
+				wins[winner]++
+			}
+		}
+		fmt.Printf("%d wins, %d losses, %d draws\n", wins[0], wins[1], *versus-wins[0]-wins[1])
+	case *tournament != "":
+		entrants, err := loadEntrants(*tournament)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runTournament(entrants, *rounds)
+	case *watch > 0:
+		initVersusRender([2]strategy{testStrat, opponentStrat}, 0, *watch)
+	case *plot != "":
+		if err := plotLog(*plot, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case *resume:
+		t, err := resumeTuner(*checkpoint, *race)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.saveFile, t.checkpointFile = *saveFile, *checkpoint
+		t.logFile, t.jsonLog = *logFile, *jsonLog
+		t.stop, t.heldOut = stop, *heldOut
+		t.run()
 	case *optimize > 0:
-		ce := testStrat.newCrossEntropy(*optimize)
-		ce.run()
+		if _, ok := optimizers[*optName]; !ok {
+			log.Fatalf("unknown optimizer %q", *optName)
+		}
+		if err := checkPopulation(*optName, *population); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(*checkpoint); *checkpoint != "" && err == nil {
+			log.Fatalf("%s holds another run. Continue it with -resume, or pick another -checkpoint.", *checkpoint)
+		}
+		if _, err := os.Stat(*jsonLog); *jsonLog != "" && err == nil {
+			log.Fatalf("%s holds another run, which would make it unplottable. Pick another -jsonlog.", *jsonLog)
+		}
+		if *seed < 0 {
+			*seed = time.Now().UnixNano()
+		}
+		t := newTuner(*optName, testStrat, *optimize, *population, *seed)
+		t.saveFile, t.checkpointFile = *saveFile, *checkpoint
+		t.logFile, t.jsonLog = *logFile, *jsonLog
+		t.stop, t.heldOut, t.racing = stop, *heldOut, *race
+		t.run()
 	default:
-		initRender()
+		initRender(opponentStrat, *pps, *shared)
 	}
 
 }
 
 var testStrat = strategy{-1.05, -3.53, -3.69, -12.23, -5.68, -8.52, -0.84, -4.49, 4.20}
+
+// parseStrategy reads comma separated weights. Only the core features are
+// required.
+func parseStrategy(str string) (strategy, error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != numCoreFeatures && len(fields) != numCoreFeatures+numChainFeatures {
+		return nil, fmt.Errorf("strategy must have %d or %d weights, got %d",
+			numCoreFeatures, numCoreFeatures+numChainFeatures, len(fields))
+	}
+	strat := make(strategy, len(fields))
+	for i, f := range fields {
+		w, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strategy weight %q", f)
+		}
+		strat[i] = w
+	}
+	return strat, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// optimizer searches for the strategy that plays best. Every iteration, the
+// candidates it proposes are played out and handed back to it best first. Its
+// state is saved as JSON in checkpoints.
+type optimizer interface {
+	candidates(random *rand.Rand, iteration int) []strategy
+	// update learns from the results of the candidates and returns the average
+	// lines of the results it learned from.
+	update(results ceResultList) float64
+	mean() strategy
+	spread() []float64 // Variance of each weight in the next candidates
+	parents() int      // Number of best results update learns from
+	// noiseAt returns how much noise the candidates of an iteration are drawn
+	// with, in the optimizer's own terms.
+	noiseAt(iteration int) float64
+	json.Marshaler
+	json.Unmarshaler
+}
+
+// optimizers maps each optimizer's name to a constructor taking the starting
+// strategy and number of candidates per iteration, where 0 picks the
+// optimizer's default.
+var optimizers = map[string]func(start strategy, population int) optimizer{
+	"ce":    newCrossEntropy,
+	"cmaes": newCMAES,
+}
+
+// minPopulations is the fewest candidates per iteration each optimizer can
+// learn from. Cross entropy estimates variances from its top tenth, which needs
+// at least two candidates, and CMA-ES learns from its better half.
+var minPopulations = map[string]int{
+	"ce":    20,
+	"cmaes": 2,
+}
+
+// checkPopulation returns an error if the optimizer cannot run with population
+// candidates per iteration. A population of 0 picks the optimizer's default.
+func checkPopulation(name string, population int) error {
+	if population != 0 && population < minPopulations[name] {
+		return fmt.Errorf("the %s optimizer needs a population of at least %d, got %d",
+			name, minPopulations[name], population)
+	}
+	return nil
+}
+
+// tuner runs an optimizer, playing out its candidates and keeping track of the
+// best strategies it has found.
+type tuner struct {
+	opt                              optimizer
+	optName                          string
+	iterations, numOfGames           int
+	lambda                           float64 // L1 regularization constant
+	bestStratSingle, bestStratMean   strategy
+	bestResultSingle, bestResultMean float64
+	stale                            int    // Iterations since the best average last improved
+	saveFile                         string // Where to save the best average strategy, if anywhere
+	checkpointFile                   string // Where to save the run's state, if anywhere
+	logFile                          string // Where to append the text log, if anywhere
+	jsonLog                          string // Where to append a JSON record of each iteration, if anywhere
+	stop                             stopCriteria
+	started                          time.Time
+	heldOut                          int  // Games in the final report
+	racing                           bool // Whether weak candidates are dropped before playing every game
+	// Candidates are drawn from random, whose source is kept to be
+	// checkpointed. The seed also decides which games each iteration plays.
+	seed   int64
+	source *countingSource
+	random *rand.Rand
+}
+
+// newTuner makes a tuner whose run is decided entirely by seed.
+func newTuner(name string, start strategy, numOfGames, population int, seed int64) tuner {
+	source := newCountingSource(seed, 0)
+	return tuner{
+		opt:        optimizers[name](start, population),
+		optName:    name,
+		lambda:     0.04 / float64(len(start)),
+		numOfGames: numOfGames,
+		seed:       seed,
+		source:     source,
+		random:     rand.New(source),
+	}
+}
+
+// stopCriteria decides when an optimizer run ends. Zero values never stop it.
+type stopCriteria struct {
+	maxIterations int
+	minVariance   float64 // Stop once every variance falls below this
+	patience      int     // Iterations without a better average before stopping
+	timeLimit     time.Duration
+}
+
+// stopReason returns why the run should stop, or an empty string if it should
+// go on.
+func (t *tuner) stopReason() string {
+	switch {
+	case t.stop.maxIterations > 0 && t.iterations >= t.stop.maxIterations:
+		return fmt.Sprintf("reached %d iterations", t.iterations)
+	case t.stop.minVariance > 0 && maxVariance(t.opt.spread()) < t.stop.minVariance:
+		return fmt.Sprintf("every variance fell below %g", t.stop.minVariance)
+	case t.stop.patience > 0 && t.stale >= t.stop.patience:
+		return fmt.Sprintf("no better average in %d iterations", t.stale)
+	case t.stop.timeLimit > 0 && time.Since(t.started) >= t.stop.timeLimit:
+		return fmt.Sprintf("ran for %v", t.stop.timeLimit)
+	}
+	return ""
+}
+
+func maxVariance(variances []float64) float64 {
+	var highest float64
+	for _, v := range variances {
+		highest = math.Max(highest, v)
+	}
+	return highest
+}
+
+func (t *tuner) run() {
+	t.started = time.Now()
+	for {
+		t.iterations++
+		start := time.Now()
+		strats := t.opt.candidates(t.random, t.iterations)
+		noise := t.opt.noiseAt(t.iterations)
+		var results ceResultList
+		if t.racing {
+			results = t.raceStrategies(strats)
+		} else {
+			results = t.testStrategies(strats)
+		}
+		sort.Stable(sort.Reverse(results))
+		t.record(t.opt.update(results))
+		t.logData(results)
+		if t.jsonLog != "" {
+			if err := t.logRecord(results, noise, time.Since(start)); err != nil {
+				log.Print(err)
+			}
+		}
+		if t.checkpointFile != "" {
+			if err := t.saveCheckpoint(t.checkpointFile); err != nil {
+				log.Print(err)
+			}
+		}
+		if reason := t.stopReason(); reason != "" {
+			t.report(reason)
+			return
+		}
+	}
+}
+
+// testStrats takes a slice of strategies, plays them out in parallel, and then
+// returns a slice of strategy-result pairs in the order of strats.
+func (t *tuner) testStrategies(strats []strategy) ceResultList {
+	jobs := make(chan int, len(strats))
+	resultChan := make(chan ceJobResult, len(strats))
+	results := make(ceResultList, len(strats))
+	for i := 0; i < len(strats); i++ {
+		jobs <- i
+	}
+	seeds := t.trainingSeeds()
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go ceWorker(jobs, resultChan, strats, seeds, t.lambda)
+	}
+	close(jobs)
+	for i := 0; i < len(strats); i++ {
+		r := <-resultChan
+		results[r.index] = r.ceResult // Kept in candidate order so ties break the same way every run
+	}
+	return results
+}
+
+// trainingSeeds returns the game seeds of the current iteration. Every
+// candidate of an iteration plays the same games, so they are compared
+// fairly, while the games change every iteration so that strategies cannot
+// overfit them. They never overlap the held-out seeds.
+func (t *tuner) trainingSeeds() []int64 {
+	r := rand.New(rand.NewSource(t.seed ^ int64(t.iterations)*0x5DEECE66D))
+	seeds := make([]int64, t.numOfGames)
+	for i := range seeds {
+		seeds[i] = r.Int63n(heldOutSeed)
+	}
+	return seeds
+}
+
+// record keeps the optimizer's mean as the best average strategy if its
+// average lines are the best yet.
+func (t *tuner) record(meanLines float64) {
+	t.stale++
+	if meanLines <= t.bestResultMean {
+		return
+	}
+	t.stale = 0
+	t.bestResultMean = meanLines
+	t.bestStratMean = append(strategy(nil), t.opt.mean()...) // Means change in place
+	if t.saveFile != "" {
+		meta := strategyMeta{
+			Run:        fmt.Sprintf("%s, %d game(s) per trial, seed %d, %s objective", t.optName, t.numOfGames, t.seed, objective),
+			Iterations: t.iterations,
+			Lines:      meanLines,
+		}
+		if err := saveStrategy(t.saveFile, t.bestStratMean, meta); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func (t *tuner) logData(results ceResultList) {
+	var sb strings.Builder
+	for i := 0; i < len(results); i++ {
+		if results[i].lines > t.bestResultSingle {
+			t.bestResultSingle = results[i].lines
+			t.bestStratSingle = results[i].strategy
+			stars := strings.Repeat("*", 30)
+			sb.WriteString(fmt.Sprintf(stars + " New Best " + stars + "\n"))
+		}
+	}
+	strFormat := "%12.0f : "
+	sb.WriteString(fmt.Sprintf(strFormat, t.bestResultMean) + t.bestStratMean.string() + " Best average\n")
+	sb.WriteString(fmt.Sprintf(strFormat, t.bestResultSingle) + t.bestStratSingle.string() + " Best single\n\n")
+	for i := 0; i < t.opt.parents(); i++ {
+		lines := results[i].lines
+		sb.WriteString(fmt.Sprintf(strFormat, lines))
+		sb.WriteString(results[i].strategy.string() + "\n")
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	info := fmt.Sprintf("%s\t seed %d\t %d game(s) per trial\t %dx%d board\t %s randomizer",
+		t.optName, t.seed, t.numOfGames, bWidth, bHeight, randomizerName)
+	if t.racing {
+		var games int
+		for _, r := range results {
+			games += r.games
+		}
+		info += fmt.Sprintf("\t raced, %d of %d games played", games, len(results)*t.numOfGames)
+	}
+	if objective != "lines" {
+		info += "\t " + objective + " objective"
+	}
+	if garbagePattern != "" {
+		info += "\t " + describeGarbage(garbagePattern, garbageInterval, garbageBatch)
+	}
+	sb.WriteString(fmt.Sprintf("\nIteration %d\t%s\t%s\n\n", t.iterations, now, info))
+	str := sb.String()
+	fmt.Print(str)
+	if t.logFile != "" {
+		writeToFile(str, t.logFile)
+	}
+}
+
+// report evaluates the final mean on the held-out seeds.
+func (t *tuner) report(reason string) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Stopped after iteration %d: %s\n", t.iterations, reason))
+	sb.WriteString("Final means: " + t.opt.mean().string() + "\n")
+	if t.heldOut > 0 {
+		results, toppedOut := playSeeds(t.opt.mean(), heldOutSeeds(t.heldOut))
+		sb.WriteString("Held-out " + summarize(results).String() + "\n")
+		if survivalEstimate {
+			// Estimated over as many games at a time as in training, so that
+			// it can be compared with the training scores.
+			var total float64
+			batches := 0
+			for i := 0; i+t.numOfGames <= len(results); i += t.numOfGames {
+				total += survivalResult(results[i:i+t.numOfGames], toppedOut[i:i+t.numOfGames])
+				batches++
+			}
+			if batches > 0 {
+				sb.WriteString(fmt.Sprintf("Held-out survival estimate %.1f, over %d batches of %d games\n",
+					total/float64(batches), batches, t.numOfGames))
+			}
+		}
+	}
+	str := sb.String()
+	fmt.Print(str)
+	if t.logFile != "" {
+		writeToFile(str, t.logFile)
+	}
+}
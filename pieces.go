@@ -18,6 +18,17 @@ const ( // Derived from printPieceBitsValues()
 
 const numPieces = 7
 
+// Piece indexes, matching the order of pieces.
+const (
+	oPiece = iota
+	iPiece
+	tPiece
+	jPiece
+	lPiece
+	sPiece
+	zPiece
+)
+
 var pieces = [numPieces]uint64{oBits, iBits, tBits, jBits, lBits, sBits, zBits}
 var tableLowerEmptyRows, tableUpperEmptyRows = getNumEmptyRows()
 
@@ -46,7 +57,9 @@ func getNumEmptyRows() ([numPieces][numForms]int, [numPieces][numForms]int) {
 	return tableLowerEmptyRows, tableUpperEmptyRows
 }
 
-var tableXStart, tableXStop = getXStartStop()
+// tableXStart and tableXStop depend on board width and are set by
+// setBoardSize.
+var tableXStart, tableXStop [numPieces][numForms]int
 
 // getXStartStop returns [piece][form]int = leftmost and rightmost x coordinate
 // a piece can reach.
@@ -57,14 +70,14 @@ func getXStartStop() ([numPieces][numForms]int, [numPieces][numForms]int) {
 	for i := 0; i < numPieces; i++ {
 		for j := 0; j < numForms; j++ {
 			for x := 0; x < maxX; x++ {
-				p := pos{i, j, bHeight / 2, x}
+				p := pos{i, j, slab, x, moveDrop}
 				if p.inBounds() {
 					tableXStart[i][j] = x
 					break
 				}
 			}
 			for x := maxX; x >= 0; x-- {
-				p := pos{i, j, bHeight / 2, x}
+				p := pos{i, j, slab, x, moveDrop}
 				if p.inBounds() {
 					tableXStop[i][j] = x
 					break
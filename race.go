@@ -0,0 +1,108 @@
+package main
+
+import (
+	"runtime"
+	"sort"
+)
+
+// raceMinGames is how many games every candidate of a race plays before any
+// can be dropped. Every round after that doubles the games played so far.
+const raceMinGames = 4
+
+// raceStrategies plays strats out like testStrategies, but in rounds. After
+// each round, a candidate is dropped when even the top of its 95% confidence
+// interval falls below the bottom of the interval of the candidate ranked at
+// the optimizer's cutoff, since it is unlikely to become a parent. The games
+// left in the race go to the candidates still in it. Dropped candidates are
+// scored on the games they played, and rank below every candidate that played
+// more games.
+func (t *tuner) raceStrategies(strats []strategy) ceResultList {
+	seeds := t.trainingSeeds()
+	scores := make([][]float64, len(strats)) // Regularized result of each game
+	lines := make([][]float64, len(strats))
+	toppedOut := make([][]bool, len(strats))
+	for i := range strats {
+		scores[i] = make([]float64, len(seeds))
+		lines[i] = make([]float64, len(seeds))
+		toppedOut[i] = make([]bool, len(seeds))
+	}
+	racing := make([]int, len(strats))
+	for i := range racing {
+		racing[i] = i
+	}
+	played := make([]int, len(strats))
+	for start, end := 0, raceMinGames; start < len(seeds); start, end = end, 2*end {
+		if end > len(seeds) {
+			end = len(seeds)
+		}
+		playRound(strats, racing, seeds, start, end, t.lambda, scores, lines, toppedOut)
+		for _, i := range racing {
+			played[i] = end
+		}
+		if end < len(seeds) {
+			racing = eliminate(racing, scores, end, t.opt.parents())
+		}
+	}
+	results := make(ceResultList, len(strats))
+	for i := range strats {
+		average := expectedResult(lines[i][:played[i]], toppedOut[i][:played[i]])
+		results[i] = ceResult{
+			strategy: strats[i],
+			score:    average - l1Regularization(average, t.lambda, strats[i]),
+			lines:    average,
+			games:    played[i],
+		}
+	}
+	return results
+}
+
+// playRound plays the games from start to end of seeds for every racing
+// candidate in parallel.
+func playRound(strats []strategy, racing []int, seeds []int64, start, end int, lambda float64, scores, lines [][]float64, toppedOut [][]bool) {
+	type game struct{ strat, seed int }
+	jobs := make(chan game, len(racing)*(end-start))
+	done := make(chan struct{}, cap(jobs))
+	for _, i := range racing {
+		for j := start; j < end; j++ {
+			jobs <- game{i, j}
+		}
+	}
+	close(jobs)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for g := range jobs {
+				result, over := gameResult(strats[g.strat], seeds[g.seed])
+				lines[g.strat][g.seed], toppedOut[g.strat][g.seed] = result, over
+				scores[g.strat][g.seed] = result - l1Regularization(result, lambda, strats[g.strat])
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		<-done
+	}
+}
+
+// eliminate returns the racing candidates that could still be among the best
+// cutoff of them, judged by the first played games of each.
+func eliminate(racing []int, scores [][]float64, played, cutoff int) []int {
+	if len(racing) <= cutoff || cutoff < 1 {
+		return racing
+	}
+	low := make([]float64, len(racing))
+	high := make([]float64, len(racing))
+	for k, i := range racing {
+		s := summarize(scores[i][:played])
+		low[k], high[k] = s.low, s.high
+	}
+	lows := append([]float64(nil), low...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(lows)))
+	threshold := lows[cutoff-1]
+	var kept []int
+	for k, i := range racing {
+		if high[k] >= threshold {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
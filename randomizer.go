@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// randomizer generates the sequence of pieces an agent receives. It is given
+// the agent's current signal and strategy, which most randomizers ignore.
+type randomizer interface {
+	next(sig signal, strat strategy) int
+}
+
+// randomizers maps each randomizer's name to a constructor taking the source
+// of randomness it draws from.
+var randomizers = map[string]func(*rand.Rand) randomizer{
+	"uniform": func(r *rand.Rand) randomizer { return uniformRandomizer{r} },
+	"bag":     func(r *rand.Rand) randomizer { return &bagRandomizer{random: r} },
+	"tgm":     newHistoryRandomizer,
+	"nes":     func(r *rand.Rand) randomizer { return &nesRandomizer{random: r, last: noPiece} },
+	"worst":   func(r *rand.Rand) randomizer { return &worstRandomizer{} },
+}
+
+// uniformRandomizer picks every piece independently with equal chance.
+type uniformRandomizer struct {
+	random *rand.Rand
+}
+
+func (u uniformRandomizer) next(sig signal, strat strategy) int {
+	return u.random.Intn(numPieces)
+}
+
+// bagRandomizer deals out a shuffled bag of all seven pieces before shuffling
+// a new one, as in modern guideline games.
+type bagRandomizer struct {
+	random *rand.Rand
+	bag    [numPieces]int
+	dealt  int
+}
+
+func (b *bagRandomizer) next(sig signal, strat strategy) int {
+	if b.dealt == 0 || b.dealt == numPieces {
+		for i := range b.bag {
+			b.bag[i] = i
+		}
+		b.random.Shuffle(numPieces, func(i, j int) { b.bag[i], b.bag[j] = b.bag[j], b.bag[i] })
+		b.dealt = 0
+	}
+	b.dealt++
+	return b.bag[b.dealt-1]
+}
+
+// historyRandomizer follows The Grand Master: it remembers the last four
+// pieces and rerolls up to four times to avoid repeating one of them. The
+// history starts full of Z pieces and the first piece is never S, Z or O.
+type historyRandomizer struct {
+	random  *rand.Rand
+	history [4]int
+	first   bool
+}
+
+const historyRolls = 4
+
+func newHistoryRandomizer(r *rand.Rand) randomizer {
+	return &historyRandomizer{
+		random:  r,
+		history: [4]int{zPiece, zPiece, zPiece, zPiece},
+		first:   true,
+	}
+}
+
+func (h *historyRandomizer) next(sig signal, strat strategy) int {
+	var piece int
+	if h.first {
+		firstPieces := [...]int{iPiece, tPiece, jPiece, lPiece}
+		piece = firstPieces[h.random.Intn(len(firstPieces))]
+		h.first = false
+	} else {
+		for i := 0; i < historyRolls; i++ {
+			piece = h.random.Intn(numPieces)
+			if !h.inHistory(piece) {
+				break
+			}
+		}
+	}
+	copy(h.history[1:], h.history[:len(h.history)-1])
+	h.history[0] = piece
+	return piece
+}
+
+func (h *historyRandomizer) inHistory(piece int) bool {
+	for _, p := range h.history {
+		if p == piece {
+			return true
+		}
+	}
+	return false
+}
+
+// nesRandomizer follows the NES game: it rolls one of eight outcomes and
+// rolls once more among the seven pieces if it got the eighth outcome or a
+// repeat of the last piece.
+type nesRandomizer struct {
+	random *rand.Rand
+	last   int
+}
+
+func (n *nesRandomizer) next(sig signal, strat strategy) int {
+	piece := n.random.Intn(numPieces + 1)
+	if piece == numPieces || piece == n.last {
+		piece = n.random.Intn(numPieces)
+	}
+	n.last = piece
+	return piece
+}
+
+// worstRandomizer is an adversary in the spirit of Bastet. It gives whichever
+// piece leaves the agent's best placement with the lowest score, picking a
+// piece that cannot be placed at all when there is one. Ties go to the lowest
+// piece index, so the sequence only depends on the agent's play. Each piece is
+// chosen against the board it is about to be played on, so it cannot be used
+// with a preview.
+type worstRandomizer struct {
+	placements []pos
+}
+
+func (w *worstRandomizer) next(sig signal, strat strategy) int {
+	worst, worstScore := 0, math.Inf(1)
+	for piece := 0; piece < numPieces; piece++ {
+		w.placements = sig.candidatePlacements(piece, w.placements[:0])
+		_, score := findBestPlacement(sig, strat, w.placements, nil)
+		if score < worstScore {
+			worst, worstScore = piece, score
+		}
+	}
+	return worst
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
@@ -39,9 +41,23 @@ var (
 		color.RGBA{0, 0, 0, 1.0}}
 )
 
-func initRender() {
+// initRender lets a human play in the window. Given a positive pps, a bot
+// playing opponent at pps pieces per second is shown on the right, exchanging
+// garbage with the human. When shared is set, both get the same pieces.
+func initRender(opponent strategy, pps float64, shared bool) {
 	keySet := getKeys()
-	cb := makeColorBoard()
+	cb := makeColorBoard(makeAgent(testStrat, 0, 0))
+	var bot colorBoard
+	if pps > 0 {
+		var seed int64 = 1
+		if shared {
+			seed = 0
+		}
+		bot = makeColorBoard(makeAgent(opponent, seed, 0))
+		cb.opponent = &bot
+		m := newMatch(&cb.agent, &bot.agent, 0)
+		cb.match, bot.match, bot.player = m, m, 1
+	}
 	size := image.Point{int(screenWidth), int(screenHeight)}
 	driver.Main(func(scre screen.Screen) {
 		win, err := scre.NewWindow(&screen.NewWindowOptions{
@@ -59,6 +75,12 @@ func initRender() {
 		}
 		defer buf.Release()
 		renderBoard(&cb, win, buf)
+		if gravityEnabled {
+			go gravityAction(&cb, buf, win)
+		}
+		if pps > 0 {
+			go botAction(&bot, &cb, pps, buf, win)
+		}
 		for {
 			e := win.NextEvent()
 			switch e := e.(type) {
@@ -70,6 +92,7 @@ func initRender() {
 
 			case key.Event:
 				if e.Direction == 2 { // Release
+					cb.mu.Lock()
 					switch e.Code {
 					case keySet.left:
 						cb.keyStamps[keySet.left] = time.Time{} // Zero value
@@ -83,6 +106,7 @@ func initRender() {
 					case keySet.down:
 						cb.keyStamps[keySet.down] = time.Time{}
 					}
+					cb.mu.Unlock()
 				} else if e.Direction == 1 { // Initial press
 					// log.Print("pressed key: ", e.Code)
 					switch e.Code {
@@ -105,17 +129,23 @@ func initRender() {
 					case keySet.lock:
 						cb.colorLock()
 
+					case keySet.hold:
+						cb.colorHold()
+
+					case keySet.hint:
+						cb.colorHint()
+
 					case keySet.cw:
-						p := cb.rotate(1)
-						if cb.allows(p) {
-							cb.updatePos(p)
-						}
+						cb.colorRotate(1)
 
 					case keySet.ccw:
-						p := cb.rotate(-1)
-						if cb.allows(p) {
-							cb.updatePos(p)
+						cb.colorRotate(-1)
+
+					case keySet.flip:
+						if !allow180 {
+							break
 						}
+						cb.colorRotate(2)
 					}
 				}
 				renderBoard(&cb, win, buf)
@@ -130,19 +160,128 @@ func initRender() {
 	})
 }
 
+// initVersusRender shows a versus match between two strategies, both getting
+// the pieces generated from seed. Each player places a piece every speed ms.
+func initVersusRender(strats [2]strategy, seed int64, speed int) {
+	left := makeColorBoard(makeAgent(strats[0], seed, speed))
+	right := makeColorBoard(makeAgent(strats[1], seed, speed))
+	left.opponent = &right
+	m := newMatch(&left.agent, &right.agent, seed)
+	left.match, right.match, right.player = m, m, 1
+	size := image.Point{int(screenWidth), int(screenHeight)}
+	driver.Main(func(scre screen.Screen) {
+		win, err := scre.NewWindow(&screen.NewWindowOptions{
+			Title:  "Dizzy",
+			Width:  size.X,
+			Height: size.Y,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer win.Release()
+		buf, err := scre.NewBuffer(size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer buf.Release()
+		renderBoard(&left, win, buf)
+		go versusAction([2]*colorBoard{&left, &right}, speed, buf, win)
+		for {
+			switch e := win.NextEvent().(type) {
+			case lifecycle.Event:
+				if e.To == lifecycle.StageDead {
+					return
+				}
+
+			case key.Event:
+				if e.Code == key.CodeEscape {
+					return
+				}
+
+			case paint.Event:
+				renderBoard(&left, win, buf)
+
+			case error:
+				log.Print(e)
+			}
+		}
+	})
+}
+
+// versusAction has both bots of a match take turns placing a piece every
+// speed ms until one of them tops out.
+func versusAction(boards [2]*colorBoard, speed int, buf screen.Buffer, win screen.Window) {
+	var searchers [2]*searcher
+	for i, cb := range boards {
+		searchers[i] = newSearcher(cb.strategy)
+	}
+	for {
+		start := time.Now()
+		var alive [2]bool
+		for i, cb := range boards {
+			alive[i] = botTurn(cb, searchers[i], start.Add(time.Duration(speed)*time.Millisecond))
+		}
+		renderBoard(boards[0], win, buf)
+		if winner, over := matchWinner(alive); over {
+			fmt.Println(describeResult(winner))
+			return
+		}
+		time.Sleep(time.Until(start.Add(time.Duration(speed) * time.Millisecond)))
+	}
+}
+
+// botAction has the bot place pps pieces per second until either it or the
+// human it plays against tops out.
+func botAction(bot, human *colorBoard, pps float64, buf screen.Buffer, win screen.Window) {
+	s := newSearcher(bot.strategy)
+	interval := time.Duration(float64(time.Second) / pps)
+	for {
+		start := time.Now()
+		human.mu.Lock()
+		alive := [2]bool{!human.signal.gameOver, true}
+		human.mu.Unlock()
+		if alive[0] {
+			alive[1] = botTurn(bot, s, start.Add(interval))
+		}
+		renderBoard(human, win, buf)
+		if winner, over := matchWinner(alive); over {
+			fmt.Println(describeResult(winner))
+			return
+		}
+		time.Sleep(time.Until(start.Add(interval)))
+	}
+}
+
+// botTurn has the bot playing cb place a piece. The search runs on a copy of
+// the bot's agent without holding cb.mu, so the window can be drawn meanwhile;
+// only the bot's goroutine changes its agent. It returns whether the bot is
+// still alive.
+func botTurn(cb *colorBoard, s *searcher, deadline time.Time) bool {
+	cb.mu.Lock()
+	a := cb.agent
+	cb.mu.Unlock()
+	a.preview = append([]int(nil), a.preview...) // Holding can advance the queue
+	next, ok := a.play(s, deadline)
+	if !ok {
+		return false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.agent = next
+	cb.colorMerge()
+	return !cb.signal.gameOver
+}
+
 func moveAction(cb *colorBoard, delta int, buf screen.Buffer, win screen.Window, key key.Code) {
 	cb.mu.Lock()
 	stamp := time.Now()
 	cb.keyStamps[key] = stamp
 	cb.mu.Unlock()
-	p := cb.move(delta)
-	if cb.allows(p) {
-		cb.updatePos(p)
-	}
+	cb.movePiece(func(p pos, b board) pos { return p.move(delta) })
 	renderBoard(cb, win, buf)
 	time.Sleep(delaySideInit * time.Millisecond)
-	if stamp == cb.keyStamps[key] {
-		cb.updatePos(cb.instantMove(delta, cb.board))
+	if cb.keyHeld(key, stamp) {
+		cb.movePiece(func(p pos, b board) pos { return p.instantMove(delta, b) })
 	}
 	renderBoard(cb, win, buf)
 }
@@ -152,37 +291,188 @@ func descendAction(cb *colorBoard, delta int, buf screen.Buffer, win screen.Wind
 	stamp := time.Now()
 	cb.keyStamps[key] = stamp
 	cb.mu.Unlock()
-	p := cb.descend(delta)
-	if cb.allows(p) {
-		cb.updatePos(p)
-	}
+	cb.movePiece(func(p pos, b board) pos { return p.descend(delta) })
 
 	renderBoard(cb, win, buf)
 	time.Sleep(delayVertInit * time.Millisecond)
-	if stamp == cb.keyStamps[key] {
-		cb.updatePos(cb.instantDescend(delta, cb.board))
+	if cb.keyHeld(key, stamp) {
+		cb.movePiece(func(p pos, b board) pos { return p.instantDescend(delta, b) })
 	}
 	renderBoard(cb, win, buf)
 }
 
+// gravityAction drops the piece one row at a time at the speed of the current
+// level. A piece that cannot fall any further locks once it has rested for
+// lockDelay. It stops when the game is over.
+func gravityAction(cb *colorBoard, buf screen.Buffer, win screen.Window) {
+	var resting time.Duration
+	pieces := -1 // Pieces locked when the current piece started resting
+	for {
+		cb.mu.Lock()
+		over, wait := cb.signal.gameOver, cb.scorer.gravity()
+		cb.mu.Unlock()
+		if over {
+			return
+		}
+		time.Sleep(wait)
+		cb.mu.Lock()
+		if cb.totalPieces != pieces {
+			// The piece was locked by hand, so a new one rests from scratch.
+			resting, pieces = 0, cb.totalPieces
+		}
+		p := cb.descend(1)
+		switch {
+		case cb.allows(p):
+			cb.pos = p
+			resting = 0
+		case resting+wait < lockDelay:
+			resting += wait
+			cb.mu.Unlock()
+			continue
+		default:
+			cb.pos = cb.instantDescend(1, cb.board)
+			cb.colorMerge()
+			resting = 0
+		}
+		cb.mu.Unlock()
+		renderBoard(cb, win, buf)
+	}
+}
+
 func drawToBuffer(img *image.RGBA, b ...*colorBoard) {
 	d := img.Bounds()
 	bufWidth := d.Dx()
 	bufHeight := d.Dy()
 	//	Each half screen's width is made up of the following parts:
-	// * Board width (10 cells wide)
+	// * Board width (bWidth cells wide)
 	// * 2 border side cells on each side of board
 	// * 1/2 empty cell on right. Then 4 cells for next preview, then another 1/2 empty cell.
 	// * empty 1/2  cell on left, then 4 for hold display, then empty 1/2 cell.
-	// Width = 44x, where x is the width and height of each cell.
-	size := int(float64(bufWidth) / 44) // Cell width and height
+	// Width = 2(bWidth+12)x, where x is the width and height of each cell. The
+	// cell size shrinks further if a tall board would not fit vertically.
 	sideCells := 5
+	size := bufWidth / (2 * (bWidth + 2 + 2*sideCells)) // Cell width and height
+	if maxSize := bufHeight / (bHeight + 2); size > maxSize {
+		size = maxSize
+	}
 	padding := (bufHeight - size*(bHeight+2)) / 2
-	startX := d.Min.X + (sideCells+1)*size // Left-most pixel on board
-	startY := d.Min.Y + padding + size     // Top-most pixel on board
+	startX := d.Min.X + (sideCells+1)*size        // Left-most pixel on board
+	startY := d.Min.Y + padding + size            // Top-most pixel on board
+	previewX := startX + (bWidth+1)*size + size/2 // Left-most pixel of next preview
 	drawBoard(img, b[0], bufWidth, size, startX, startY)
+	drawHold(img, b[0], size, d.Min.X+size/2, startY)
+	drawScore(img, b[0], size, d.Min.X+size/2, startY+(pieceRows+1)*size)
+	drawPreview(img, b[0], size, previewX, startY)
 	if len(b) > 1 {
 		drawBoard(img, b[1], bufWidth, size, startX+bufWidth/2, startY)
+		drawHold(img, b[1], size, d.Min.X+bufWidth/2+size/2, startY)
+		drawScore(img, b[1], size, d.Min.X+bufWidth/2+size/2, startY+(pieceRows+1)*size)
+		drawPreview(img, b[1], size, previewX+bufWidth/2, startY)
+	}
+}
+
+// drawPreview draws the upcoming pieces top to bottom in a column 4 cells wide
+// whose top-left pixel is at startX, startY. Each piece gets 3 rows of cells
+// since a piece's spawn orientation leaves the top and bottom rows of its
+// frame empty. Pieces that do not fit within the board's height are left out.
+func drawPreview(img *image.RGBA, b *colorBoard, size, startX, startY int) {
+	stopY := startY + (bHeight+1)*size
+	for x := startX; x < startX+formCols*size; x++ {
+		for y := startY; y < stopY; y++ {
+			img.SetRGBA(x, y, colors[black])
+		}
+	}
+	slot := 3 * size
+	for i, piece := range b.preview {
+		top := startY + i*slot
+		if top+slot > stopY {
+			break
+		}
+		// Shift up one row to skip the empty top row of the piece's frame.
+		drawPiece(img, piece, colors[piece], size, startX, top-size)
+	}
+}
+
+// drawHold draws the held piece in the 4x4 cell area whose top-left pixel is
+// at startX, startY. The piece is grayed out while it cannot be held again.
+func drawHold(img *image.RGBA, b *colorBoard, size, startX, startY int) {
+	for x := startX; x < startX+formCols*size; x++ {
+		for y := startY; y < startY+pieceRows*size; y++ {
+			img.SetRGBA(x, y, colors[black])
+		}
+	}
+	if b.hold == noPiece {
+		return
+	}
+	c := colors[b.hold]
+	if b.holdUsed {
+		c = colors[gray]
+	}
+	drawPiece(img, b.hold, c, size, startX, startY)
+}
+
+// Digits 3 pixels wide and 5 tall, top row in the highest bits and the left
+// pixel of each row in the highest of its 3 bits.
+var digitGlyphs = [10]uint16{
+	0b111_101_101_101_111, 0b010_110_010_010_111, 0b111_001_111_100_111,
+	0b111_001_111_001_111, 0b101_101_111_001_001, 0b111_100_111_001_111,
+	0b111_100_111_101_111, 0b111_001_010_010_010, 0b111_101_111_101_111,
+	0b111_101_111_001_111,
+}
+
+// drawScore draws the score above the level in an area 4 cells wide whose
+// top-left pixel is at startX, startY. Digits are scaled so that 8 fit across.
+func drawScore(img *image.RGBA, b *colorBoard, size, startX, startY int) {
+	unit := size / 8
+	if unit < 1 {
+		unit = 1
+	}
+	lineHeight := 7 * unit
+	for x := startX; x < startX+formCols*size; x++ {
+		for y := startY; y < startY+2*lineHeight; y++ {
+			img.SetRGBA(x, y, colors[black])
+		}
+	}
+	drawNumber(img, b.scorer.score(), colors[white], unit, startX, startY)
+	drawNumber(img, b.scorer.level(), colors[gray], unit, startX, startY+lineHeight)
+}
+
+// drawNumber draws n in digits made of unit sized pixels, starting with the
+// top-left pixel at startX, startY.
+func drawNumber(img *image.RGBA, n int, c color.RGBA, unit, startX, startY int) {
+	for i, r := range strconv.Itoa(n) {
+		glyph := digitGlyphs[r-'0']
+		left := startX + i*4*unit
+		for bit := 0; bit < 15; bit++ {
+			if glyph>>(14-bit)&1 == 0 {
+				continue
+			}
+			x0, y0 := left+bit%3*unit, startY+bit/3*unit
+			for x := x0; x < x0+unit; x++ {
+				for y := y0; y < y0+unit; y++ {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+}
+
+// drawPiece draws a piece's spawn orientation within a 4x4 cell area whose
+// top-left pixel is at startX, startY.
+func drawPiece(img *image.RGBA, piece int, c color.RGBA, size, startX, startY int) {
+	for i := 0; i < pieceRows; i++ {
+		row := pos{piece: piece}.pieceBits(i)
+		for j := 0; j < formCols; j++ {
+			if row>>(bWidth+formCols-1-j)&1 == 0 {
+				continue
+			}
+			top := startY + size*(pieceRows-1-i)
+			for x := startX + size*j; x < startX+size*(j+1); x++ {
+				for y := top; y < top+size; y++ {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
 	}
 }
 
@@ -234,15 +524,20 @@ func drawBoard(img *image.RGBA, b *colorBoard, bufWidth, size, startX, startY in
 }
 
 // colorBoard is a layer maintained outside of core game logic used for keeping
-// track of the rendering/key interface separate from the bot logic.
+// track of the rendering/key interface separate from the bot logic. An
+// opponent's board is drawn beside it, and locks settle garbage with the
+// opponent when the board plays in a match as the given player.
 type colorBoard struct {
 	cells [][]int
 	agent
+	opponent  *colorBoard
+	match     *match
+	player    int
 	keyStamps map[key.Code]time.Time // timeStamp of last move
 	mu        sync.Mutex
 }
 
-func makeColorBoard() colorBoard {
+func makeColorBoard(a agent) colorBoard {
 	b := make([][]int, numRows)
 	for i := range b {
 		b[i] = make([]int, bWidth)
@@ -251,13 +546,14 @@ func makeColorBoard() colorBoard {
 		}
 	}
 	return colorBoard{
-		agent:     makeAgent(testStrat, 0, 0),
+		agent:     a,
 		cells:     b,
 		keyStamps: make(map[key.Code]time.Time),
 	}
 }
 
-// colorMerge merges current piece into color board.
+// colorMerge merges current piece into color board. The caller must hold
+// cb.mu.
 func (cb *colorBoard) colorMerge() {
 	for i := 0; i < pieceRows; i++ {
 		cells := cb.pieceBits(i)
@@ -287,22 +583,82 @@ func (cb *colorBoard) colorMerge() {
 			}
 		}
 	}
+	garbage := cb.garbageRows + cb.totalGarbage
 	cb.agent = cb.lockAndNewPiece()
+	if cb.match != nil {
+		cb.match.exchange(cb.player)
+	}
+	cb.colorGarbage(garbage)
 }
 
-func (cb *colorBoard) updatePos(p pos) {
+// colorGarbage shifts the colors up to make room for garbage pushed in since
+// the board had received the given rows of garbage in total.
+func (cb *colorBoard) colorGarbage(garbage int) {
+	if pushed := cb.garbageRows + cb.totalGarbage - garbage; pushed > 0 {
+		top := append([][]int(nil), cb.cells[len(cb.cells)-pushed:]...)
+		copy(cb.cells[slab+pushed:], cb.cells[slab:len(cb.cells)-pushed])
+		copy(cb.cells[slab:], top)
+		for i := slab; i < slab+pushed; i++ {
+			for j := range cb.cells[i] {
+				cb.cells[i][j] = black
+				if cb.board[i]>>j&1 != 0 {
+					cb.cells[i][j] = gray
+				}
+			}
+		}
+	}
+}
+
+// movePiece moves the piece to where move takes it on the board, if the board
+// allows it.
+func (cb *colorBoard) movePiece(move func(pos, board) pos) {
 	cb.mu.Lock()
-	cb.pos = p
+	if p := move(cb.pos, cb.board); cb.allows(p) {
+		cb.pos = p
+	}
+	cb.mu.Unlock()
+}
+
+// keyHeld reports whether key is still held since it was pressed at stamp.
+func (cb *colorBoard) keyHeld(key key.Code, stamp time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return stamp == cb.keyStamps[key]
+}
+
+func (cb *colorBoard) colorRotate(delta int) {
+	cb.mu.Lock()
+	if p, ok := rotationSys.rotate(cb.board, cb.pos, delta); ok {
+		cb.pos = p
+	}
 	cb.mu.Unlock()
 }
 
 func (cb *colorBoard) colorLock() {
-	cb.updatePos(cb.instantDescend(1, cb.board))
+	cb.mu.Lock()
+	cb.pos = cb.instantDescend(1, cb.board)
 	cb.colorMerge()
+	cb.mu.Unlock()
+}
+
+func (cb *colorBoard) colorHold() {
+	cb.mu.Lock()
+	cb.agent = cb.holdPiece()
+	cb.mu.Unlock()
+}
+
+// colorHint moves the piece to where the strategy would place it, holding
+// first if the strategy would.
+func (cb *colorBoard) colorHint() {
+	cb.mu.Lock()
+	if next, ok := cb.play(newSearcher(cb.strategy), time.Time{}); ok {
+		cb.agent = next
+	}
+	cb.mu.Unlock()
 }
 
 type keySet struct {
-	left, right, up, down, lock, cw, ccw key.Code
+	left, right, up, down, lock, cw, ccw, flip, hold, hint key.Code
 }
 
 func getKeys() keySet {
@@ -314,13 +670,22 @@ func getKeys() keySet {
 		lock:  key.CodeJ,
 		cw:    key.CodeSemicolon,
 		ccw:   key.CodeK,
+		flip:  key.CodeL,
+		hold:  key.CodeSpacebar,
+		hint:  key.CodeH,
 	}
 }
 
 func renderBoard(cb *colorBoard, win screen.Window, buf screen.Buffer) {
 	cb.mu.Lock()
 	cb.print()
-	drawToBuffer(buf.RGBA(), cb)
+	if cb.opponent != nil {
+		cb.opponent.mu.Lock()
+		drawToBuffer(buf.RGBA(), cb, cb.opponent)
+		cb.opponent.mu.Unlock()
+	} else {
+		drawToBuffer(buf.RGBA(), cb)
+	}
 	win.Upload(image.Point{}, buf, buf.Bounds())
 	cb.mu.Unlock()
 }
@@ -0,0 +1,86 @@
+package main
+
+// rotationSystem decides where a piece ends up when rotated by delta quarter
+// turns clockwise, returning false if the rotation is blocked.
+type rotationSystem interface {
+	rotate(b board, p pos, delta int) (pos, bool)
+}
+
+var rotationSystems = map[string]rotationSystem{
+	"simple": simpleRotation{},
+	"srs":    srsRotation{},
+}
+
+// simpleRotation turns the piece in place and fails if it no longer fits.
+type simpleRotation struct{}
+
+func (simpleRotation) rotate(b board, p pos, delta int) (pos, bool) {
+	p = p.rotate(delta)
+	return p, b.allows(p)
+}
+
+// srsRotation implements the Super Rotation System. The piece forms already
+// match SRS's rotation states, so a rotation tries each kick offset for the
+// transition in turn and keeps the first one that fits. SRS has no 180
+// rotations, so those use the kicks popularized by TETR.IO.
+type srsRotation struct{}
+
+// kick is an offset tried when rotating. Positive x is right and positive y
+// is up, the same as pos.
+type kick struct {
+	x, y int
+}
+
+// Kicks indexed by [from form][to form] for J, L, S, T and Z.
+var srsKicks = [numForms][numForms][]kick{
+	0: {1: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}}, 3: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}}},
+	1: {0: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}}, 2: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}}},
+	2: {1: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}}, 3: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}}},
+	3: {2: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}}, 0: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}}},
+}
+
+// Kicks indexed by [from form][to form] for I.
+var srsKicksI = [numForms][numForms][]kick{
+	0: {1: {{0, 0}, {-2, 0}, {1, 0}, {-2, -1}, {1, 2}}, 3: {{0, 0}, {-1, 0}, {2, 0}, {-1, 2}, {2, -1}}},
+	1: {0: {{0, 0}, {2, 0}, {-1, 0}, {2, 1}, {-1, -2}}, 2: {{0, 0}, {-1, 0}, {2, 0}, {-1, 2}, {2, -1}}},
+	2: {1: {{0, 0}, {1, 0}, {-2, 0}, {1, -2}, {-2, 1}}, 3: {{0, 0}, {2, 0}, {-1, 0}, {2, 1}, {-1, -2}}},
+	3: {2: {{0, 0}, {-2, 0}, {1, 0}, {-2, -1}, {1, 2}}, 0: {{0, 0}, {1, 0}, {-2, 0}, {1, -2}, {-2, 1}}},
+}
+
+// Kicks indexed by from form for 180 rotations of every piece but O.
+var srsKicks180 = [numForms][]kick{
+	{{0, 0}, {0, 1}, {1, 1}, {-1, 1}, {1, 0}, {-1, 0}},
+	{{0, 0}, {1, 0}, {1, 2}, {1, 1}, {0, 2}, {0, 1}},
+	{{0, 0}, {0, -1}, {-1, -1}, {1, -1}, {-1, 0}, {1, 0}},
+	{{0, 0}, {-1, 0}, {-1, 2}, {-1, 1}, {0, 2}, {0, 1}},
+}
+
+var noKicks = []kick{{0, 0}}
+
+func (srsRotation) rotate(b board, p pos, delta int) (pos, bool) {
+	to := p.rotate(delta)
+	kicks := noKicks
+	switch {
+	case p.piece == oPiece:
+	case to.form == (p.form+2)%numForms:
+		kicks = srsKicks180[p.form]
+	case p.piece == iPiece:
+		kicks = srsKicksI[p.form][to.form]
+	default:
+		kicks = srsKicks[p.form][to.form]
+	}
+	for i, k := range kicks {
+		kicked := to
+		kicked.x += k.x
+		kicked.y += k.y
+		if b.allows(kicked) {
+			// A T using the last kick of a quarter turn, as in a T-spin triple,
+			// always counts as a full spin.
+			if p.piece == tPiece && i == 4 && len(kicks) == 5 {
+				kicked.lastMove = moveKick
+			}
+			return kicked, true
+		}
+	}
+	return p, false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// iterationRecord is one line of the JSON log of an optimizer run, which the
+// seed identifies. Noise is what the iteration's candidates were drawn with,
+// while the means and variances are those of the next iteration.
+type iterationRecord struct {
+	Iteration  int               `json:"iteration"`
+	Seed       int64             `json:"seed"`
+	Time       time.Time         `json:"time"`
+	Seconds    float64           `json:"seconds"` // Time the iteration took
+	Optimizer  string            `json:"optimizer"`
+	Means      strategy          `json:"means"`
+	Variances  []float64         `json:"variances"`
+	Noise      float64           `json:"noise"`
+	Candidates []candidateRecord `json:"candidates"` // Best first
+	BestSingle bestRecord        `json:"bestSingle"`
+	BestMean   bestRecord        `json:"bestMean"`
+}
+
+type candidateRecord struct {
+	Strategy strategy `json:"strategy"`
+	Score    float64  `json:"score"`
+	Lines    float64  `json:"lines"`
+	Games    int      `json:"games"`
+}
+
+type bestRecord struct {
+	Lines    float64  `json:"lines"`
+	Strategy strategy `json:"strategy"`
+}
+
+// logRecord appends the iteration's record to the JSON log.
+func (t *tuner) logRecord(results ceResultList, noise float64, took time.Duration) error {
+	rec := iterationRecord{
+		Iteration:  t.iterations,
+		Seed:       t.seed,
+		Time:       time.Now(),
+		Seconds:    took.Seconds(),
+		Optimizer:  t.optName,
+		Means:      t.opt.mean(),
+		Variances:  t.opt.spread(),
+		Noise:      noise,
+		Candidates: make([]candidateRecord, len(results)),
+		BestSingle: bestRecord{t.bestResultSingle, t.bestStratSingle},
+		BestMean:   bestRecord{t.bestResultMean, t.bestStratMean},
+	}
+	for i, r := range results {
+		rec.Candidates[i] = candidateRecord{r.strategy, r.score, r.lines, r.games}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(t.jsonLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// plotLog turns the JSON log of an optimizer run into CSV with one row per
+// iteration, ready to be charted. Besides the bests and the noise, each row
+// has the average and top lines of the candidates, and the mean and variance
+// of every weight. Seconds count the time spent on iterations, so that the
+// time a resumed run was stopped is left out. A resumed run can replay
+// iterations logged after its checkpoint, in which case the later records
+// replace the earlier ones. Logs of more than one run are rejected.
+func plotLog(file string, w io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var first iterationRecord
+	var rows [][]string
+	var iterations []int
+	var seconds []float64 // Time spent up to the end of each row's iteration
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<26) // Records of large populations are long
+	for line := 1; scanner.Scan(); line++ {
+		var rec iterationRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+		if line == 1 {
+			first = rec
+		} else if rec.Seed != first.Seed || rec.Optimizer != first.Optimizer || len(rec.Means) != len(first.Means) {
+			return fmt.Errorf("%s:%d: starts another run, with seed %d and %s instead of seed %d and %s; "+
+				"give each run its own log", file, line, rec.Seed, rec.Optimizer, first.Seed, first.Optimizer)
+		}
+		for n := len(rows); n > 0 && iterations[n-1] >= rec.Iteration; n-- {
+			rows, iterations, seconds = rows[:n-1], iterations[:n-1], seconds[:n-1]
+		}
+		elapsed := rec.Seconds
+		if len(seconds) > 0 {
+			elapsed += seconds[len(seconds)-1]
+		}
+		rows = append(rows, plotRow(rec, elapsed))
+		iterations = append(iterations, rec.Iteration)
+		seconds = append(seconds, elapsed)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	out := csv.NewWriter(w)
+	out.Write(plotHeader(len(first.Means)))
+	out.WriteAll(rows)
+	return out.Error()
+}
+
+func plotRow(rec iterationRecord, seconds float64) []string {
+	var total, top float64
+	for i, c := range rec.Candidates {
+		total += c.Lines
+		if i == 0 || c.Lines > top {
+			top = c.Lines
+		}
+	}
+	row := []string{
+		strconv.Itoa(rec.Iteration),
+		formatFloat(seconds),
+		formatFloat(rec.BestMean.Lines),
+		formatFloat(rec.BestSingle.Lines),
+		formatFloat(total / float64(len(rec.Candidates))),
+		formatFloat(top),
+		formatFloat(rec.Noise),
+	}
+	for i := range rec.Means {
+		row = append(row, formatFloat(rec.Means[i]), formatFloat(rec.Variances[i]))
+	}
+	return row
+}
+
+func plotHeader(weights int) []string {
+	header := []string{"iteration", "seconds", "bestMean", "bestSingle", "averageLines", "topLines", "noise"}
+	for i := 0; i < weights; i++ {
+		name := strconv.Itoa(i)
+		if i < len(featureNames) {
+			name = featureNames[i]
+		}
+		header = append(header, "mean_"+name, "variance_"+name)
+	}
+	return header
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// scoringSystem awards points for locks and decides how levels progress and
+// how fast pieces fall. Since systems remember previous locks, every agent
+// gets its own.
+type scoringSystem interface {
+	// lock records a lock given the signal right after it.
+	lock(s signal)
+	score() int
+	level() int
+	// gravity returns how long a piece takes to fall one row at the current
+	// level.
+	gravity() time.Duration
+}
+
+// scoringSystems maps each scoring system's name to a constructor taking the
+// starting level.
+var scoringSystems = map[string]func(int) scoringSystem{
+	"nes":       func(start int) scoringSystem { return &nesScoring{progress: progress{lvl: start}, start: start} },
+	"guideline": newGuidelineScoring,
+	"tgm":       func(start int) scoringSystem { return &tgmScoring{progress: progress{lvl: start}, combo: 1} },
+}
+
+// progress holds the score and level common to every scoring system.
+type progress struct {
+	points, lvl int
+}
+
+func (p progress) score() int { return p.points }
+func (p progress) level() int { return p.lvl }
+
+// framesToDuration converts frames at the given frame rate to a duration.
+func framesToDuration(frames, fps float64) time.Duration {
+	return time.Duration(frames / fps * float64(time.Second))
+}
+
+// nesScoring follows the NES game. Points are multiplied by the level plus
+// one, and the first level up takes longer when starting on a high level.
+type nesScoring struct {
+	progress
+	start int
+}
+
+const nesFPS = 60.0988
+
+var nesPoints = [...]int{0, 40, 100, 300, 1200}
+
+// Frames per row for levels 0 to 29. Later levels drop one row per frame.
+var nesFrames = [...]float64{48, 43, 38, 33, 28, 23, 18, 13, 8, 6, 5, 5, 5, 4, 4, 4, 3, 3, 3,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1}
+
+func (n *nesScoring) lock(s signal) {
+	n.points += nesPoints[s.lines] * (n.lvl + 1)
+	first := n.start*10 + 10
+	if alt := n.start*10 - 50; alt > 100 {
+		first = min(first, alt)
+	} else {
+		first = min(first, 100)
+	}
+	if s.totalLines >= first {
+		n.lvl = n.start + 1 + (s.totalLines-first)/10
+	}
+}
+
+func (n *nesScoring) gravity() time.Duration {
+	if n.lvl >= len(nesFrames) {
+		return framesToDuration(1, nesFPS)
+	}
+	return framesToDuration(nesFrames[n.lvl], nesFPS)
+}
+
+// guidelineScoring follows the modern guideline: points depend on spins and
+// lines, consecutive clears build a combo, and chains of tetrises and spins
+// earn a back-to-back bonus. Levels go up every 10 lines, starting at 1.
+type guidelineScoring struct {
+	progress
+	start int
+}
+
+// Points at level 1, indexed by [spin kind][lines]. Spins by pieces other
+// than T are scored as minis.
+var guidelinePoints = [...][5]int{
+	noSpin:   {0, 100, 300, 500, 800},
+	miniSpin: {100, 200, 400, 0, 0},
+	fullSpin: {400, 800, 1200, 1600, 0},
+}
+
+const guidelineMaxLevel = 20
+
+func newGuidelineScoring(start int) scoringSystem {
+	if start < 1 {
+		start = 1
+	}
+	return &guidelineScoring{progress: progress{lvl: start}, start: start}
+}
+
+func (g *guidelineScoring) lock(s signal) {
+	spin := s.spin
+	if spin == fullSpin && s.piece != tPiece {
+		spin = miniSpin
+	}
+	points := guidelinePoints[spin][s.lines] * g.lvl
+	if s.lines > 0 {
+		if s.backToBack > 0 {
+			points = points * 3 / 2
+		}
+		points += 50 * s.combo * g.lvl
+	}
+	g.points += points
+	g.lvl = g.start + s.totalLines/10
+}
+
+func (g *guidelineScoring) gravity() time.Duration {
+	l := float64(min(g.lvl, guidelineMaxLevel) - 1)
+	return time.Duration(math.Pow(0.8-l*0.007, l) * float64(time.Second))
+}
+
+// tgmScoring follows The Grand Master. The level goes up by one for every
+// piece, except when it would pass a multiple of 100, and by one for every
+// line. Combos multiply the points and clearing the whole board quadruples
+// them. Levels run from 0 to 999.
+type tgmScoring struct {
+	progress
+	combo int
+}
+
+const (
+	tgmFPS      = 60
+	tgmMaxLevel = 999
+)
+
+// Gravity in 256ths of a row per frame, starting from each level in
+// tgmGravityLevels.
+var (
+	tgmGravityLevels = [...]int{0, 30, 35, 40, 50, 60, 70, 80, 90, 100, 120, 140, 160, 170,
+		200, 220, 230, 233, 236, 239, 243, 247, 251, 300, 330, 360, 400, 420, 450, 500}
+	tgmGravity = [...]int{4, 6, 8, 10, 12, 16, 32, 48, 64, 80, 96, 112, 128, 144,
+		4, 32, 64, 96, 128, 160, 192, 224, 256, 512, 768, 1024, 1280, 1024, 768, 5120}
+)
+
+func (t *tgmScoring) lock(s signal) {
+	if s.lines > 0 {
+		t.combo += 2*s.lines - 2
+		bravo := 1
+		if s.isEmpty() {
+			bravo = 4
+		}
+		t.points += (t.lvl + s.lines + 3) / 4 * s.lines * t.combo * bravo
+		t.lvl += s.lines
+	} else {
+		t.combo = 1
+	}
+	if t.lvl%100 != 99 && t.lvl < tgmMaxLevel-1 {
+		t.lvl++
+	}
+	t.lvl = min(t.lvl, tgmMaxLevel)
+}
+
+func (t *tgmScoring) gravity() time.Duration {
+	g := tgmGravity[0]
+	for i, l := range tgmGravityLevels {
+		if t.lvl >= l {
+			g = tgmGravity[i]
+		}
+	}
+	return framesToDuration(256/float64(g), tgmFPS)
+}
+
+// isEmpty checks if every column of the board is empty.
+func (s signal) isEmpty() bool {
+	for col := 0; col < bWidth; col++ {
+		if s.colHeights[col] != 0 {
+			return false
+		}
+	}
+	return true
+}
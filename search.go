@@ -0,0 +1,242 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// searcher looks ahead through future pieces to choose a placement. Pieces in
+// the preview are known, so the searcher simply picks the best placement for
+// each of them in turn. When expectimax is enabled and the search goes deeper
+// than the preview, every one of the possible next pieces is tried and their
+// results are blended together at a chance node. Beam search instead only
+// keeps the best few boards at each ply.
+type searcher struct {
+	strat strategy
+	// Each ply of the search reuses its own slices to save allocation time.
+	placements [][]pos
+	scores     [][]float64
+	beam, next []beamNode
+}
+
+func newSearcher(strat strategy) *searcher {
+	s := &searcher{
+		strat:      strat,
+		placements: make([][]pos, searchDepth),
+		scores:     make([][]float64, searchDepth),
+	}
+	for i := 0; i < searchDepth; i++ {
+		s.placements[i] = make([]pos, 0, bWidth*numForms)
+		s.scores[i] = make([]float64, 0, bWidth*numForms)
+	}
+	return s
+}
+
+// scoreBuffer returns n reusable scores for a ply, growing its buffer when a
+// reachability search finds more placements than the heightmap can.
+func (s *searcher) scoreBuffer(ply, n int) []float64 {
+	if cap(s.scores[ply]) < n {
+		s.scores[ply] = make([]float64, 0, n)
+	}
+	return s.scores[ply][:n]
+}
+
+// bestMove returns the best placement for the agent's active piece, or for
+// the piece it would get by holding, along with whether to hold first. When
+// both are searched, each gets half of the time left before deadline. It
+// returns the zero pos if no placement is found.
+func (s *searcher) bestMove(a agent, deadline time.Time) (pos, bool) {
+	if !holdEnabled || a.holdUsed {
+		p, _ := s.bestPlacement(a.signal, a.piece, a.preview, deadline)
+		return p, false
+	}
+	piece, queue := a.hold, a.preview
+	if piece == noPiece {
+		if len(queue) == 0 {
+			// The piece we would get is unknown, so there is nothing to compare.
+			p, _ := s.bestPlacement(a.signal, a.piece, a.preview, deadline)
+			return p, false
+		}
+		piece, queue = queue[0], queue[1:]
+	}
+	preview := a.preview
+	if searchMode != "expectimax" {
+		// Only expectimax searches past the last known piece, so the other
+		// modes must search both branches through as many known pieces for
+		// their scores to be comparable.
+		n := min(len(preview), len(queue), searchDepth-1)
+		preview, queue = preview[:n], queue[:n]
+	}
+	halfway := deadline
+	if !deadline.IsZero() {
+		halfway = time.Now().Add(time.Until(deadline) / 2)
+	}
+	p, score := s.bestPlacement(a.signal, a.piece, preview, halfway)
+	held, heldScore := s.bestPlacement(a.signal, piece, queue, deadline)
+	if held != (pos{}) && (heldScore > score || p == (pos{})) {
+		return held, true
+	}
+	return p, false
+}
+
+// bestPlacement returns the placement for piece that leads to the best
+// scoring board searchDepth pieces later, along with that board's score.
+// Anytime beam search keeps widening its beam until deadline, while the other
+// modes ignore it. It returns the zero pos if no placement is found.
+func (s *searcher) bestPlacement(sig signal, piece int, preview []int, deadline time.Time) (pos, float64) {
+	if len(preview) > searchDepth-1 {
+		preview = preview[:searchDepth-1]
+	}
+	if searchMode == "beam" {
+		return s.anytimeBeam(sig, piece, preview, deadline)
+	}
+	return s.decide(sig, piece, preview, 0)
+}
+
+// decide returns the best placement for piece along with the score it leads
+// to. The pieces in queue follow it, and any plies past the end of queue are
+// handled by chance nodes.
+func (s *searcher) decide(sig signal, piece int, queue []int, ply int) (pos, float64) {
+	placements := sig.candidatePlacements(piece, s.placements[ply][:0])
+	s.placements[ply] = placements
+	if ply == searchDepth-1 {
+		return findBestPlacement(sig, s.strat, placements, nil)
+	}
+	if searchPrune > 0 && len(placements) > searchPrune {
+		// Only expand the candidates that look best right now.
+		scores := s.scoreBuffer(ply, len(placements))
+		findBestPlacement(sig, s.strat, placements, scores)
+		selectBest(placements, scores, searchPrune)
+		placements = placements[:searchPrune]
+	}
+	bestScore := math.Inf(-1)
+	var bestPlacement pos
+	for _, p := range placements {
+		c := sig.lock(p)
+		if c.gameOver {
+			continue
+		}
+		var score float64
+		if len(queue) > 0 {
+			_, score = s.decide(c, queue[0], queue[1:], ply+1)
+		} else {
+			score = s.chance(c, ply+1)
+		}
+		// Even if no later piece fits, still return a placement for this one.
+		if score > bestScore || bestPlacement == (pos{}) {
+			bestScore = score
+			bestPlacement = p
+		}
+	}
+	return bestPlacement, bestScore
+}
+
+// chance returns the value of a board when the next piece is unknown. The
+// average over all pieces is blended with the worst piece's score by
+// searchRisk, where 0 is the plain average and 1 only considers the worst.
+func (s *searcher) chance(sig signal, ply int) float64 {
+	var total float64
+	worst := math.Inf(1)
+	for piece := 0; piece < numPieces; piece++ {
+		_, score := s.decide(sig, piece, nil, ply)
+		if math.IsInf(score, -1) {
+			return score // Some piece tops out no matter where it goes.
+		}
+		total += score
+		if score < worst {
+			worst = score
+		}
+	}
+	return (1-searchRisk)*total/numPieces + searchRisk*worst
+}
+
+// selectBest moves the n highest scoring placements to the front of
+// placements, keeping scores in step.
+func selectBest(placements []pos, scores []float64, n int) {
+	for i := 0; i < n; i++ {
+		best := i
+		for j := i + 1; j < len(scores); j++ {
+			if scores[j] > scores[best] {
+				best = j
+			}
+		}
+		placements[i], placements[best] = placements[best], placements[i]
+		scores[i], scores[best] = scores[best], scores[i]
+	}
+}
+
+// beamNode is a board reached during beam search along with the placement of
+// the first piece that led to it.
+type beamNode struct {
+	signal
+	first pos
+	score float64
+}
+
+// anytimeBeam runs a beam search of beamWidth, then keeps doubling the width
+// and searching again until deadline passes or the beam no longer drops any
+// boards. The result of the widest search to finish is returned. A zero
+// deadline runs only the first search.
+func (s *searcher) anytimeBeam(sig signal, piece int, queue []int, deadline time.Time) (pos, float64) {
+	best, bestScore, exhaustive, _ := s.beamSearch(sig, piece, queue, beamWidth, time.Time{})
+	if deadline.IsZero() {
+		return best, bestScore
+	}
+	for width := beamWidth * 2; !exhaustive; width *= 2 {
+		p, score, exh, finished := s.beamSearch(sig, piece, queue, width, deadline)
+		if !finished {
+			break
+		}
+		best, bestScore, exhaustive = p, score, exh
+	}
+	return best, bestScore
+}
+
+// beamSearch places piece and then each piece of queue, keeping only the
+// width best scoring boards after every ply. It returns the first placement
+// leading to the best board of the deepest ply with any survivors, that
+// board's score, whether no board was ever dropped from the beam, and whether
+// it finished before deadline. A zero deadline never expires.
+func (s *searcher) beamSearch(sig signal, piece int, queue []int, width int, deadline time.Time) (pos, float64, bool, bool) {
+	exhaustive := true
+	s.beam = append(s.beam[:0], beamNode{signal: sig})
+	for ply := 0; ply <= len(queue); ply++ {
+		if ply > 0 {
+			piece = queue[ply-1]
+		}
+		s.next = s.next[:0]
+		for _, n := range s.beam {
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				return pos{}, math.Inf(-1), exhaustive, false
+			}
+			placements := n.candidatePlacements(piece, s.placements[0][:0])
+			s.placements[0] = placements
+			scores := s.scoreBuffer(0, len(placements))
+			findBestPlacement(n.signal, s.strat, placements, scores)
+			for i, p := range placements {
+				if math.IsInf(scores[i], -1) {
+					continue // Tops out.
+				}
+				first := n.first
+				if ply == 0 {
+					first = p
+				}
+				s.next = append(s.next, beamNode{n.lock(p), first, scores[i]})
+			}
+		}
+		if len(s.next) == 0 {
+			break // Nothing survives this ply, so settle for the last one.
+		}
+		sort.Slice(s.next, func(i, j int) bool { return s.next[i].score > s.next[j].score })
+		if len(s.next) > width {
+			s.next = s.next[:width]
+			exhaustive = false
+		}
+		s.beam, s.next = s.next, s.beam
+	}
+	if len(s.beam) == 1 && s.beam[0].first == (pos{}) {
+		return pos{}, math.Inf(-1), exhaustive, true // No placement at all.
+	}
+	return s.beam[0].first, s.beam[0].score, exhaustive, true
+}
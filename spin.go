@@ -0,0 +1,76 @@
+package main
+
+// Kinds of spin a lock can be.
+const (
+	noSpin = iota
+	miniSpin
+	fullSpin
+)
+
+var spinNames = [...]string{"", " mini", ""}
+var lineNames = [...]string{"", " single", " double", " triple", " tetris"}
+var pieceNames = [numPieces]string{"O", "I", "T", "J", "L", "S", "Z"}
+
+// T corners, as [form][corner] row and frame column pairs. The first two
+// corners of each form are the front corners, on the side the T points to.
+// Frame columns count from the right, so column 3 is the left side of the T.
+var tCorners = [numForms][4][2]int{
+	{{2, 3}, {2, 1}, {0, 3}, {0, 1}}, // Pointing up
+	{{2, 1}, {0, 1}, {2, 3}, {0, 3}}, // Pointing right
+	{{0, 3}, {0, 1}, {2, 3}, {2, 1}}, // Pointing down
+	{{2, 3}, {0, 3}, {2, 1}, {0, 1}}, // Pointing left
+}
+
+// spinOf classifies locking p on the board before it is merged. A T that last
+// rotated is a spin when three of the corners around its center are blocked,
+// and a full spin when both front corners are blocked or it used the kick
+// that always counts as full. Otherwise, if immobile spins are enabled, any
+// piece that last rotated and cannot move left, right or up is a spin; a full
+// one for pieces other than T.
+func (b board) spinOf(p pos) int {
+	if p.lastMove == moveDrop {
+		return noSpin
+	}
+	if p.piece == tPiece {
+		var corners, front int
+		for i, c := range tCorners[p.form] {
+			if b.blocked(p.y+c[0], bWidth+c[1]-p.x) {
+				corners++
+				if i < 2 {
+					front++
+				}
+			}
+		}
+		switch {
+		case corners < 3:
+		case front == 2 || p.lastMove == moveKick:
+			return fullSpin
+		default:
+			return miniSpin
+		}
+	}
+	if !immobileSpins || b.allows(p.move(-1)) || b.allows(p.move(1)) || b.allows(p.descend(-1)) {
+		return noSpin
+	}
+	if p.piece == tPiece {
+		return miniSpin
+	}
+	return fullSpin
+}
+
+// blocked checks if a cell is filled or outside the walls and floor.
+func (b board) blocked(row, col int) bool {
+	return row < slab || col < 0 || col >= bWidth || b[row]>>col&1 != 0
+}
+
+// clearName describes the last lock, such as "T-spin mini double" or
+// "tetris". It is empty when the lock was neither a spin nor a clear.
+func (s signal) clearName() string {
+	if s.spin == noSpin {
+		if s.lines == 0 {
+			return ""
+		}
+		return lineNames[s.lines][1:]
+	}
+	return pieceNames[s.piece] + "-spin" + spinNames[s.spin] + lineNames[s.lines]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// featureVersion must go up whenever a feature is added, removed or changes
+// meaning, so that strategies tuned for other features are not loaded.
+const featureVersion = 1
+
+// featureNames names the weight at each index of a strategy.
+var featureNames = [numCoreFeatures + numChainFeatures]string{
+	"weightedRows", "rowTransitions", "colTransitions", "rowsWithHoles",
+	"wells2Deep", "wells3Deep", "holeQuota", "wellTraps", "safeSZ",
+	"combo", "backToBack",
+}
+
+// strategyFile is the JSON form of a strategy, with weights keyed by feature
+// name.
+type strategyFile struct {
+	Version int                `json:"version"`
+	Weights map[string]float64 `json:"weights"`
+	Meta    strategyMeta       `json:"meta"`
+}
+
+// strategyMeta records how a strategy was tuned.
+type strategyMeta struct {
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Randomizer string  `json:"randomizer,omitempty"`
+	Run        string  `json:"run,omitempty"` // Describes the tuning run
+	Iterations int     `json:"iterations,omitempty"`
+	Lines      float64 `json:"lines,omitempty"` // Average result when saved
+	Saved      string  `json:"saved,omitempty"`
+}
+
+// loadStrategy reads a strategy file. Every core feature must have a weight,
+// and the chain features must either all have one or all be left out.
+func loadStrategy(file string) (strategy, strategyMeta, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, strategyMeta{}, err
+	}
+	var sf strategyFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, strategyMeta{}, fmt.Errorf("%s: %v", file, err)
+	}
+	if sf.Version != featureVersion {
+		return nil, strategyMeta{}, fmt.Errorf("%s was saved with feature version %d, but this build uses version %d",
+			file, sf.Version, featureVersion)
+	}
+	index := make(map[string]int, len(featureNames))
+	for i, name := range featureNames {
+		index[name] = i
+	}
+	for name := range sf.Weights {
+		if _, ok := index[name]; !ok {
+			return nil, strategyMeta{}, fmt.Errorf("%s: unknown feature %q", file, name)
+		}
+	}
+	size := numCoreFeatures
+	if len(sf.Weights) > numCoreFeatures {
+		size += numChainFeatures
+	}
+	strat := make(strategy, size)
+	for i := range strat {
+		w, ok := sf.Weights[featureNames[i]]
+		if !ok {
+			return nil, strategyMeta{}, fmt.Errorf("%s: missing weight for feature %q", file, featureNames[i])
+		}
+		strat[i] = w
+	}
+	return strat, sf.Meta, nil
+}
+
+// saveStrategy writes strat to a strategy file, filling in the board size,
+// randomizer and time of saving.
+func saveStrategy(file string, strat strategy, meta strategyMeta) error {
+	meta.Width, meta.Height, meta.Randomizer = bWidth, bHeight, randomizerName
+	meta.Saved = time.Now().Format(time.RFC3339)
+	sf := strategyFile{Version: featureVersion, Weights: make(map[string]float64, len(strat)), Meta: meta}
+	for i, w := range strat {
+		sf.Weights[featureNames[i]] = w
+	}
+	data, err := json.MarshalIndent(sf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return replaceFile(file, append(data, '\n'))
+}
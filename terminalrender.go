@@ -22,7 +22,8 @@ func (a agent) print() {
 		sb.WriteString(row + "\n")
 	}
 	pieceInserted := insertPieceInStr(sb.String(), a.pos)
-	debugInserted := insertDebugInfo(pieceInserted, a.signal)
+	previewInserted := insertPreview(pieceInserted, a.preview)
+	debugInserted := insertDebugInfo(previewInserted, a.signal)
 	sb.Reset()
 	sb.WriteString(" " + strings.Repeat("__", bWidth) + "\n") // Top border
 	sb.WriteString(debugInserted)
@@ -30,6 +31,7 @@ func (a agent) print() {
 	for i := 0; i < bWidth; i++ {
 		sb.WriteString(strconv.Itoa(i+1) + " ") // Column labels
 	}
+	sb.WriteString(fmt.Sprintf("\n score %d, level %d", a.scorer.score(), a.scorer.level()))
 	fmt.Printf(sb.String() + "\n")
 }
 
@@ -44,8 +46,9 @@ func insertDebugInfo(str string, s signal) string {
 	rows[index%bHeight] = rows[index%bHeight] + fmt.Sprintf("\t%2dy %2dx, %d pieces, %d lines",
 		s.y, s.x, c.totalPieces, c.totalLines)
 
-	var heightDiffs [bWidth - 1]int
-	for i := 0; i < len(c.colHeights)-1; i++ {
+	var heightDiffArr [maxWidth - 1]int
+	heightDiffs := heightDiffArr[:bWidth-1]
+	for i := 0; i < len(heightDiffs); i++ {
 		heightDiffs[i] = c.colHeights[i] - c.colHeights[i+1]
 	}
 
@@ -206,6 +209,45 @@ func insertPieceInStr(str string, p pos) string {
 	return sb.String()
 }
 
+// previewSlotRows is the number of text rows given to each preview piece. A
+// piece in its spawn orientation only fills the middle two rows of its frame,
+// so the slot is those two rows plus a blank spacer.
+const previewSlotRows = 3
+
+// insertPreview adds a column showing the upcoming pieces to the right of the
+// board. Pieces that do not fit within the board's height are left out.
+func insertPreview(str string, preview []int) string {
+	if len(preview) == 0 {
+		return str
+	}
+	rows := strings.Split(str, "\n")
+	rows = rows[:len(rows)-1]
+	for i := 0; i < len(rows); i++ {
+		slot, line := i/previewSlotRows, i%previewSlotRows
+		if slot >= len(preview) || line == previewSlotRows-1 || (slot+1)*previewSlotRows-1 > len(rows) {
+			rows[i] += " " + strings.Repeat(strEmptyCell, formCols)
+			continue
+		}
+		// Frame rows are indexed from the bottom, skipping the empty top row.
+		rows[i] += " " + stringPieceRow(preview[slot], pieceRows-2-line)
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+// stringPieceRow returns one row of a piece's spawn orientation.
+func stringPieceRow(piece, row int) string {
+	var sb strings.Builder
+	bits := pos{piece: piece}.pieceBits(row) >> bWidth
+	for j := formCols - 1; j >= 0; j-- {
+		if bits>>j&1 != 0 {
+			sb.WriteString(strPieceCell)
+		} else {
+			sb.WriteString(strEmptyCell)
+		}
+	}
+	return sb.String()
+}
+
 func stringRow(r uint64) string {
 	var sb strings.Builder
 	sb.WriteString("|") // Left side border
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// entrant is a strategy taking part in a tournament, along with its record.
+type entrant struct {
+	name                string
+	strat               strategy
+	wins, losses, draws int
+	elo, margin         float64 // Rating and half-width of its 95% interval
+}
+
+// loadEntrants reads one strategy per line as comma separated weights,
+// optionally preceded by a name and a colon. Blank lines and lines starting
+// with # are skipped.
+func loadEntrants(file string) ([]entrant, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entrants []entrant
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name := "#" + strconv.Itoa(line)
+		if i := strings.Index(text, ":"); i >= 0 {
+			name, text = strings.TrimSpace(text[:i]), text[i+1:]
+		}
+		strat, err := parseStrategy(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", file, line, err)
+		}
+		entrants = append(entrants, entrant{name: name, strat: strat})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entrants) < 2 {
+		return nil, fmt.Errorf("%s: a tournament needs at least 2 strategies, got %d", file, len(entrants))
+	}
+	return entrants, nil
+}
+
+// pairing is one match of a tournament. Player 1 of the match is entrant a.
+type pairing struct {
+	a, b   int
+	seed   int64
+	winner int // As returned by playMatch
+}
+
+// runTournament plays every pair of entrants against each other on seeds 0
+// to rounds-1, once from each side, then rates the entrants.
+func runTournament(entrants []entrant, rounds int) {
+	var pairings []pairing
+	for a := range entrants {
+		for b := a + 1; b < len(entrants); b++ {
+			for seed := 0; seed < rounds; seed++ {
+				pairings = append(pairings, pairing{a: a, b: b, seed: int64(seed)},
+					pairing{a: b, b: a, seed: int64(seed)})
+			}
+		}
+	}
+	jobs := make(chan int, len(pairings))
+	done := make(chan int, len(pairings))
+	for i := range pairings {
+		jobs <- i
+	}
+	close(jobs)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			for j := range jobs {
+				p := &pairings[j]
+				p.winner = playMatch([2]strategy{entrants[p.a].strat, entrants[p.b].strat}, p.seed)
+				done <- j
+			}
+		}()
+	}
+	for range pairings {
+		<-done
+	}
+	for _, p := range pairings {
+		switch p.winner {
+		case 0:
+			entrants[p.a].wins++
+			entrants[p.b].losses++
+		case 1:
+			entrants[p.a].losses++
+			entrants[p.b].wins++
+		default:
+			entrants[p.a].draws++
+			entrants[p.b].draws++
+		}
+	}
+	rateEntrants(entrants, pairings)
+	printLeaderboard(entrants)
+}
+
+// Elo points per unit of logistic rating, and the rating everyone starts at.
+const (
+	eloScale = 400 / math.Ln10
+	eloBase  = 1500
+)
+
+// rateEntrants finds the ratings that make the results most likely under the
+// Elo model, counting a draw as half a win. Every entrant also gets a virtual
+// draw against a player rated eloBase, which keeps ratings finite for
+// entrants that won or lost every match. Intervals come from the curvature of
+// the likelihood around each rating.
+func rateEntrants(entrants []entrant, pairings []pairing) {
+	n := len(entrants)
+	score := make([][]float64, n) // Points scored by i against j
+	games := make([][]float64, n)
+	for i := range score {
+		score[i] = make([]float64, n)
+		games[i] = make([]float64, n)
+	}
+	for _, p := range pairings {
+		games[p.a][p.b]++
+		games[p.b][p.a]++
+		switch p.winner {
+		case 0:
+			score[p.a][p.b]++
+		case 1:
+			score[p.b][p.a]++
+		default:
+			score[p.a][p.b] += 0.5
+			score[p.b][p.a] += 0.5
+		}
+	}
+	expected := func(r, opp float64) float64 { return 1 / (1 + math.Exp(opp-r)) }
+	ratings := make([]float64, n)
+	info := make([]float64, n)
+	for iter := 0; iter < 1000; iter++ {
+		var change float64
+		for i := range ratings {
+			e := expected(ratings[i], 0)
+			grad, curv := 0.5-e, e*(1-e)
+			for j := range ratings {
+				if games[i][j] == 0 {
+					continue
+				}
+				e := expected(ratings[i], ratings[j])
+				grad += score[i][j] - games[i][j]*e
+				curv += games[i][j] * e * (1 - e)
+			}
+			step := grad / curv
+			ratings[i] += step
+			info[i] = curv
+			change = math.Max(change, math.Abs(step))
+		}
+		if change < 1e-9 {
+			break
+		}
+	}
+	for i := range entrants {
+		entrants[i].elo = eloBase + ratings[i]*eloScale
+		entrants[i].margin = 1.96 * eloScale / math.Sqrt(info[i])
+	}
+}
+
+func printLeaderboard(entrants []entrant) {
+	sorted := append([]entrant(nil), entrants...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].elo > sorted[j].elo })
+	fmt.Printf("%4s  %-20s %6s %7s %6s %6s %6s\n", "rank", "strategy", "elo", "95%", "wins", "losses", "draws")
+	for i, e := range sorted {
+		fmt.Printf("%4d  %-20s %6.0f %7s %6d %6d %6d\n", i+1, e.name, e.elo,
+			fmt.Sprintf("±%.0f", e.margin), e.wins, e.losses, e.draws)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// attackTable decides how many rows of garbage a clear sends. Spins by pieces
+// other than T are treated as minis.
+type attackTable struct {
+	lines      [5]int // Indexed by lines cleared without a spin
+	spin, mini [5]int // Indexed by lines cleared with a spin
+	backToBack int    // Bonus while a back-to-back chain continues
+	combo      []int  // Bonus by combo count, the last entry repeating
+	allClear   int    // Bonus for emptying the board
+}
+
+var attackTables = map[string]attackTable{
+	"guideline": {
+		lines:      [5]int{0, 0, 1, 2, 4},
+		spin:       [5]int{0, 2, 4, 6, 0},
+		mini:       [5]int{0, 0, 1, 0, 0},
+		backToBack: 1,
+		combo:      []int{0, 0, 1, 1, 1, 2, 2, 3, 3, 4, 4, 4, 5},
+		allClear:   10,
+	},
+	"classic": {
+		lines: [5]int{0, 0, 1, 2, 4},
+		spin:  [5]int{0, 0, 1, 2, 4},
+		mini:  [5]int{0, 0, 1, 2, 4},
+	},
+}
+
+// parseAttackTable returns the attack table with the given name, or else
+// reads name as the rows sent by single, double, triple and tetris separated
+// by commas, with no bonuses.
+func parseAttackTable(name string) (attackTable, error) {
+	if t, ok := attackTables[name]; ok {
+		return t, nil
+	}
+	fields := strings.Split(name, ",")
+	if len(fields) != 4 {
+		return attackTable{}, fmt.Errorf("attack table must be one of guideline or classic, or 4 comma separated rows, got %q", name)
+	}
+	var t attackTable
+	for i, f := range fields {
+		rows, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || rows < 0 {
+			return attackTable{}, fmt.Errorf("attack table rows must be non-negative integers, got %q", f)
+		}
+		t.lines[i+1] = rows
+	}
+	t.spin, t.mini = t.lines, t.lines
+	return t, nil
+}
+
+// attack returns the rows of garbage sent by the lock that led to s.
+func (t attackTable) attack(s signal) int {
+	if s.lines == 0 {
+		return 0
+	}
+	var rows int
+	switch {
+	case s.spin == fullSpin && s.piece == tPiece:
+		rows = t.spin[s.lines]
+	case s.spin != noSpin:
+		rows = t.mini[s.lines]
+	default:
+		rows = t.lines[s.lines]
+	}
+	if s.backToBack > 0 {
+		rows += t.backToBack
+	}
+	if len(t.combo) > 0 {
+		rows += t.combo[min(s.combo, len(t.combo)-1)]
+	}
+	if s.isEmpty() {
+		rows += t.allClear
+	}
+	return rows
+}
+
+// match pits two agents against each other. Garbage a player sends first
+// cancels its own incoming garbage, and the rest is queued for the opponent.
+// Queued garbage is pushed in whenever a player locks a piece without
+// clearing a line, each attack as one clean batch with a single hole. Players
+// in the window lock pieces concurrently, so exchanges are serialized by mu.
+type match struct {
+	mu       sync.Mutex
+	players  [2]*agent
+	incoming [2][]int // Rows of each queued attack, oldest first
+	holes    [2]garbageGenerator
+}
+
+func newMatch(a, b *agent, seed int64) *match {
+	m := &match{players: [2]*agent{a, b}}
+	for i := range m.holes {
+		m.holes[i] = garbagePatterns["clean"](rand.New(rand.NewSource(garbageSeed(seed + int64(i)))))
+	}
+	return m
+}
+
+// exchange settles garbage after player i has locked a piece.
+func (m *match) exchange(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.players[i]
+	sent := attackRules.attack(a.signal)
+	for sent > 0 && len(m.incoming[i]) > 0 {
+		cancelled := min(sent, m.incoming[i][0])
+		sent -= cancelled
+		m.incoming[i][0] -= cancelled
+		if m.incoming[i][0] == 0 {
+			m.incoming[i] = m.incoming[i][1:]
+		}
+	}
+	if sent > 0 {
+		m.incoming[1-i] = append(m.incoming[1-i], sent)
+	}
+	if a.lines > 0 {
+		return
+	}
+	for _, rows := range m.incoming[i] {
+		a.signal = a.pushGarbage(m.holes[i].holes(rows))
+	}
+	m.incoming[i] = m.incoming[i][:0]
+}
+
+// turn has player i place one piece with searcher s, then settles garbage. It
+// returns false once the player has topped out.
+func (m *match) turn(i int, s *searcher, deadline time.Time) bool {
+	a := m.players[i]
+	next, ok := a.play(s, deadline)
+	if !ok {
+		return false
+	}
+	*a = next.lockAndNewPiece()
+	m.exchange(i)
+	return !a.signal.gameOver
+}
+
+// Pieces each player places before a match is called a draw.
+const matchPieceLimit = 10000
+
+// playMatch plays a versus match between two strategies, both receiving the
+// pieces generated from seed. Players take turns placing one piece each. It
+// returns the index of the player who tops out last, or -1 for a draw.
+func playMatch(strats [2]strategy, seed int64) int {
+	var players [2]agent
+	var searchers [2]*searcher
+	for i := range players {
+		players[i] = makeAgent(strats[i], seed, 0)
+		searchers[i] = newSearcher(strats[i])
+	}
+	m := newMatch(&players[0], &players[1], seed)
+	for piece := 0; piece < matchPieceLimit; piece++ {
+		var alive [2]bool
+		for i := range players {
+			alive[i] = m.turn(i, searchers[i], time.Time{})
+		}
+		if winner, over := matchWinner(alive); over {
+			return winner
+		}
+	}
+	return -1
+}
+
+// matchWinner returns the index of the player left alive, or -1 if both
+// topped out together, along with whether the match is over.
+func matchWinner(alive [2]bool) (int, bool) {
+	switch {
+	case alive[0] && alive[1]:
+		return 0, false
+	case alive[0]:
+		return 0, true
+	case alive[1]:
+		return 1, true
+	}
+	return -1, true
+}
+
+// describeResult describes the winner of a match as returned by playMatch.
+func describeResult(winner int) string {
+	if winner < 0 {
+		return "draw"
+	}
+	return fmt.Sprintf("player %d wins", winner+1)
+}